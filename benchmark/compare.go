@@ -0,0 +1,306 @@
+package benchmark
+
+import (
+	"fmt"
+	"iam-performance-test/db"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Comparable percentiles of a Comparison.
+const (
+	PercentileP50  = "p50"
+	PercentileP90  = "p90"
+	PercentileP99  = "p99"
+	PercentileP999 = "p999"
+)
+
+// Comparison is the outcome of comparing the scenarios of a head report with those of a base report.
+type Comparison struct {
+	// Percentile is the compared percentile, e.g. "p99".
+	Percentile string
+	// Threshold is the relative increase of Percentile in percent beyond which a significant change is a regression.
+	Threshold float64
+	// Alpha is the significance level of the Mann-Whitney U test.
+	Alpha     float64
+	Scenarios []ScenarioComparison
+	// Missing are scenarios of only one of the reports.
+	Missing []string
+}
+
+// ScenarioComparison compares a scenario of two reports.
+type ScenarioComparison struct {
+	// Name is the label of the scenario, see ScenarioReport.Label.
+	Name string
+	Base Percentiles
+	Head Percentiles
+	// Delta is the relative change of the compared percentile in percent, positive when head is slower.
+	Delta float64
+	// Slower and Faster are the one-sided Mann-Whitney U test p-values of the head latency samples tending to be
+	// larger, respectively smaller, than the base ones.
+	Slower, Faster float64
+	Regression     bool
+	// PlanChanges are the query plans of differing shape when both reports captured the plans of the scenario.
+	PlanChanges []PlanChange
+}
+
+// PlanChange is a scenario query whose plan differs in shape between two reports.
+type PlanChange struct {
+	// Query is the 1-based index of the query among the scenario queries.
+	Query int
+	// Base and Head are the plan shapes, empty for a query of only one report.
+	Base, Head string
+}
+
+// Compare matches the scenarios of two reports by label, i.e. by name and schema. A scenario regresses when its
+// percentile grows by more than threshold percent and its head latency samples are significantly slower at the alpha
+// significance level.
+func Compare(base, head *Report, percentile string, threshold, alpha float64) (*Comparison, error) {
+	if _, err := percentileOf(Percentiles{}, percentile); err != nil {
+		return nil, err
+	}
+
+	res := &Comparison{Percentile: percentile, Threshold: threshold, Alpha: alpha}
+
+	heads := make(map[string]*ScenarioReport, len(head.Scenarios))
+	for i := range head.Scenarios {
+		heads[head.Scenarios[i].Label()] = &head.Scenarios[i]
+	}
+
+	for i := range base.Scenarios {
+		b := &base.Scenarios[i]
+
+		h, ok := heads[b.Label()]
+		if !ok {
+			res.Missing = append(res.Missing, b.Label())
+			continue
+		}
+
+		delete(heads, b.Label())
+
+		before, _ := percentileOf(b.Percentiles, percentile)
+		after, _ := percentileOf(h.Percentiles, percentile)
+
+		c := ScenarioComparison{Name: b.Label(), Base: b.Percentiles, Head: h.Percentiles, Delta: relativeDelta(before, after)}
+		c.Slower, c.Faster = MannWhitneyU(b.Samples, h.Samples)
+		c.Regression = c.Delta > threshold && c.Slower < alpha
+		c.PlanChanges = planChanges(b.Plans, h.Plans)
+
+		res.Scenarios = append(res.Scenarios, c)
+	}
+
+	for i := range head.Scenarios {
+		if _, ok := heads[head.Scenarios[i].Label()]; ok {
+			res.Missing = append(res.Missing, head.Scenarios[i].Label())
+		}
+	}
+
+	return res, nil
+}
+
+// Regressions returns the names of regressed scenarios.
+func (c *Comparison) Regressions() []string {
+	var res []string
+
+	for i := range c.Scenarios {
+		if c.Scenarios[i].Regression {
+			res = append(res, c.Scenarios[i].Name)
+		}
+	}
+
+	return res
+}
+
+// PlanChanged returns the names of scenarios whose query plans changed.
+func (c *Comparison) PlanChanged() []string {
+	var res []string
+
+	for i := range c.Scenarios {
+		if len(c.Scenarios[i].PlanChanges) > 0 {
+			res = append(res, c.Scenarios[i].Name)
+		}
+	}
+
+	return res
+}
+
+// WriteMarkdown renders the comparison as a Markdown table. Latencies are in milliseconds.
+func (c *Comparison) WriteMarkdown(w io.Writer) error {
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "| Scenario | Base p50 | Head p50 | Base p99 | Head p99 | Δ %s | p slower | p faster | Result |\n", c.Percentile)
+	b.WriteString("|---|--:|--:|--:|--:|--:|--:|--:|---|\n")
+
+	for _, s := range c.Scenarios {
+		result := "unchanged"
+
+		switch {
+		case s.Regression:
+			result = "**regression**"
+		case s.Slower < c.Alpha:
+			result = "slower"
+		case s.Faster < c.Alpha:
+			result = "faster"
+		}
+
+		if len(s.PlanChanges) > 0 {
+			result += ", plan changed"
+		}
+
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s | %+.1f%% | %.4f | %.4f | %s |\n", s.Name,
+			milliseconds(s.Base.P50), milliseconds(s.Head.P50), milliseconds(s.Base.P99), milliseconds(s.Head.P99),
+			s.Delta, s.Slower, s.Faster, result)
+	}
+
+	if len(c.PlanChanged()) > 0 {
+		b.WriteString("\nChanged query plans:\n\n")
+
+		for _, s := range c.Scenarios {
+			for _, change := range s.PlanChanges {
+				fmt.Fprintf(b, "- %s query %d: %s → %s\n", s.Name, change.Query, planShape(change.Base), planShape(change.Head))
+			}
+		}
+	}
+
+	if len(c.Missing) > 0 {
+		fmt.Fprintf(b, "\nScenarios in one report only: %s\n", strings.Join(c.Missing, ", "))
+	}
+
+	fmt.Fprintf(b, "\nLatencies are in milliseconds. Regression: %s over %.1f%% with p < %g.\n", c.Percentile, c.Threshold, c.Alpha)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// MannWhitneyU returns the one-sided p-values of the Mann-Whitney U test of samples of b tending to be larger,
+// respectively smaller, than samples of a. It uses the normal approximation with tie and continuity corrections,
+// which is accurate from about 8 samples each. Both are 1 when either a or b is empty.
+func MannWhitneyU(a, b []time.Duration) (larger, smaller float64) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1, 1
+	}
+
+	type sample struct {
+		value time.Duration
+		first bool
+	}
+
+	samples := make([]sample, 0, len(a)+len(b))
+	for _, v := range a {
+		samples = append(samples, sample{value: v, first: true})
+	}
+
+	for _, v := range b {
+		samples = append(samples, sample{value: v})
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	// Sum the ranks of a, averaging the ranks of ties, and the tie correction term
+	var rankSum, ties float64
+
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2 // Ranks are 1-based: the average of i+1..j
+
+		for k := i; k < j; k++ {
+			if samples[k].first {
+				rankSum += rank
+			}
+		}
+
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	// U of a counts the pairs in which the sample of a is larger, so it is small when b tends to be larger
+	n := n1 + n2
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+
+	if sigma == 0 {
+		return 1, 1
+	}
+
+	return upperTail((mean - u - 0.5) / sigma), upperTail((u - mean - 0.5) / sigma)
+}
+
+// planChanges compares the plan shapes of the scenario queries, unless either report has no plans.
+func planChanges(base, head []db.QueryPlan) []PlanChange {
+	if len(base) == 0 || len(head) == 0 {
+		return nil
+	}
+
+	var res []PlanChange
+
+	for i := 0; i < len(base) || i < len(head); i++ {
+		var change PlanChange
+
+		if i < len(base) {
+			change.Base = base[i].Facts.Shape
+		}
+
+		if i < len(head) {
+			change.Head = head[i].Facts.Shape
+		}
+
+		if change.Base != change.Head {
+			change.Query = i + 1
+			res = append(res, change)
+		}
+	}
+
+	return res
+}
+
+func planShape(shape string) string {
+	if shape == "" {
+		return "(none)"
+	}
+
+	return "`" + shape + "`"
+}
+
+// upperTail returns the probability of a standard normal variable exceeding z.
+func upperTail(z float64) float64 {
+	return math.Erfc(z/math.Sqrt2) / 2
+}
+
+func percentileOf(p Percentiles, name string) (time.Duration, error) {
+	switch name {
+	case PercentileP50:
+		return p.P50, nil
+	case PercentileP90:
+		return p.P90, nil
+	case PercentileP99:
+		return p.P99, nil
+	case PercentileP999:
+		return p.P999, nil
+	}
+
+	return 0, fmt.Errorf("unknown percentile %q", name)
+}
+
+// relativeDelta returns the change from before to after in percent.
+func relativeDelta(before, after time.Duration) float64 {
+	if before == 0 {
+		if after == 0 {
+			return 0
+		}
+
+		return math.Inf(1)
+	}
+
+	return float64(after-before) / float64(before) * 100
+}
@@ -0,0 +1,55 @@
+package benchmark
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func durations(values ...int) []time.Duration {
+	res := make([]time.Duration, len(values))
+	for i, v := range values {
+		res[i] = time.Duration(v) * time.Millisecond
+	}
+
+	return res
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	// Ranks of a are 1-4 and the tied 5.5, 7.5, 9.5 and 11.5, so U of a is 44-36 = 8 against a mean of 32. The four
+	// pairs of ties reduce the variance to 64/12 * (17 - 24/240), i.e. σ = 9.4939, so the one-sided p-values are the
+	// normal tails of (32-8-0.5)/σ and (8-32-0.5)/σ.
+	a := durations(1, 2, 3, 4, 5, 6, 7, 8)
+	b := durations(5, 6, 7, 8, 9, 10, 11, 12)
+
+	for _, tt := range []struct {
+		name            string
+		a, b            []time.Duration
+		larger, smaller float64
+	}{
+		{"b larger with ties", a, b, 0.0066565, 0.9950688},
+		{"b smaller with ties", b, a, 0.9950688, 0.0066565},
+		{"a empty", nil, b, 1, 1},
+		{"b empty", a, nil, 1, 1},
+		{"both empty", nil, nil, 1, 1},
+		{"all equal", durations(3, 3, 3, 3), durations(3, 3, 3), 1, 1},
+		{"single samples equal", durations(3), durations(3), 1, 1},
+	} {
+		larger, smaller := MannWhitneyU(tt.a, tt.b)
+
+		if math.Abs(larger-tt.larger) > 1e-6 || math.Abs(smaller-tt.smaller) > 1e-6 {
+			t.Errorf("%s: got p-values %.7f, %.7f, want %.7f, %.7f", tt.name, larger, smaller, tt.larger, tt.smaller)
+		}
+	}
+}
+
+func TestMannWhitneyUIdentical(t *testing.T) {
+	a := durations(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	larger, smaller := MannWhitneyU(a, a)
+
+	// U equals its mean, so only the continuity correction moves the p-values off one half
+	if larger != smaller || larger < 0.5 || larger > 0.6 {
+		t.Errorf("got p-values %.4f, %.4f, want equal ones slightly above 0.5", larger, smaller)
+	}
+}
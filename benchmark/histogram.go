@@ -0,0 +1,179 @@
+package benchmark
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// subBucketBits sets the histogram precision: every power-of-two range of values is split into 2^(subBucketBits-1)
+// linear buckets, so a recorded value is off by less than 1/2^(subBucketBits-1), i.e. under 1%.
+const subBucketBits = 8
+
+const (
+	subBucketCount     = 1 << subBucketBits
+	subBucketHalfCount = subBucketCount / 2
+)
+
+// Histogram records latencies into log-linear buckets in the manner of an HDR histogram: memory stays bounded for
+// any number of samples and any range of values, while percentiles keep a fixed relative precision.
+//
+// The zero value is an empty histogram. Histogram is not safe for concurrent use; record into one histogram per
+// goroutine and Merge them instead.
+type Histogram struct {
+	counts   []int64
+	count    int64
+	sum      int64
+	min, max int64
+}
+
+// Percentiles are the latency percentiles reported for a scenario.
+type Percentiles struct {
+	Min  time.Duration `json:"min"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+	Max  time.Duration `json:"max"`
+}
+
+// Record adds a latency sample. Negative latencies are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+
+	i := bucketIndex(v)
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+
+	h.counts[i]++
+
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+
+	if v > h.max {
+		h.max = v
+	}
+
+	h.count++
+	h.sum += v
+}
+
+// Merge adds all samples of o.
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+
+	if len(o.counts) > len(h.counts) {
+		counts := make([]int64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+
+	if o.max > h.max {
+		h.max = o.max
+	}
+
+	h.count += o.count
+	h.sum += o.sum
+}
+
+// Count returns the number of recorded samples.
+func (h *Histogram) Count() int64 { return h.count }
+
+// Min returns the exact smallest sample.
+func (h *Histogram) Min() time.Duration { return time.Duration(h.min) }
+
+// Max returns the exact largest sample.
+func (h *Histogram) Max() time.Duration { return time.Duration(h.max) }
+
+// Mean returns the exact average sample.
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	return time.Duration(h.sum / h.count)
+}
+
+// Percentile returns the sample at or below which p percent of samples fall, e.g. 99.9. The result is the highest
+// value equivalent to the sample within the histogram precision, but never exceeds Max.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	if p <= 0 {
+		return h.Min()
+	}
+
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	if rank > h.count {
+		rank = h.count
+	}
+
+	var seen int64
+
+	for i, c := range h.counts {
+		if seen += c; seen >= rank {
+			if v := bucketHighest(i); v < h.max {
+				return time.Duration(v)
+			}
+
+			break
+		}
+	}
+
+	return h.Max()
+}
+
+// Percentiles returns the reported percentiles.
+func (h *Histogram) Percentiles() Percentiles {
+	return Percentiles{
+		Min:  h.Min(),
+		P50:  h.Percentile(50),
+		P90:  h.Percentile(90),
+		P99:  h.Percentile(99),
+		P999: h.Percentile(99.9),
+		Max:  h.Max(),
+	}
+}
+
+// bucketIndex returns the bucket of a non-negative value. Values below subBucketCount have a bucket each, while every
+// following power-of-two range is split into subBucketHalfCount buckets.
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+
+	shift := bits.Len64(uint64(v)) - subBucketBits
+
+	return shift*subBucketHalfCount + int(v>>uint(shift))
+}
+
+// bucketHighest returns the highest value of the bucket.
+func bucketHighest(i int) int64 {
+	if i < subBucketCount {
+		return int64(i)
+	}
+
+	shift := (i - subBucketHalfCount) / subBucketHalfCount
+	sub := int64(i - shift*subBucketHalfCount)
+
+	return (sub+1)<<uint(shift) - 1
+}
@@ -0,0 +1,119 @@
+package benchmark
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// maxRelativeError is the precision promised by subBucketBits.
+const maxRelativeError = 0.01
+
+func TestBucketBounds(t *testing.T) {
+	values := []int64{0, 1, subBucketCount - 1, subBucketCount, subBucketCount + 1, 1000, 1 << 20, 1<<20 - 1, 1<<20 + 1,
+		int64(time.Millisecond), int64(time.Second), int64(time.Hour), math.MaxInt64 / 2}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10_000; i++ {
+		values = append(values, r.Int63n(int64(time.Minute)))
+	}
+
+	for _, v := range values {
+		i := bucketIndex(v)
+		highest := bucketHighest(i)
+
+		if v > highest {
+			t.Fatalf("value %d above the highest value %d of its bucket %d", v, highest, i)
+		}
+
+		if i > 0 && bucketHighest(i-1) >= v {
+			t.Fatalf("value %d not above the highest value %d of the bucket %d below its bucket", v, bucketHighest(i-1), i-1)
+		}
+
+		if bucketIndex(highest) != i {
+			t.Fatalf("highest value %d of bucket %d is in bucket %d", highest, i, bucketIndex(highest))
+		}
+
+		if v < subBucketCount && highest != v {
+			t.Fatalf("value %d below %d shares bucket %d up to %d", v, subBucketCount, i, highest)
+		}
+
+		if err := float64(highest-v) / float64(v); v > 0 && err >= maxRelativeError {
+			t.Fatalf("value %d in bucket %d up to %d is off by %.4f", v, i, highest, err)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	samples := make([]time.Duration, 100_000)
+	for i := range samples {
+		// Log-normally distributed around a millisecond, spanning several powers of two
+		samples[i] = time.Duration(math.Exp(r.NormFloat64()*2) * float64(time.Millisecond))
+	}
+
+	var h Histogram
+	for _, sample := range samples {
+		h.Record(sample)
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	if h.Min() != samples[0] || h.Max() != samples[len(samples)-1] {
+		t.Errorf("min %v, max %v, want %v, %v", h.Min(), h.Max(), samples[0], samples[len(samples)-1])
+	}
+
+	for _, p := range []float64{1, 10, 50, 90, 99, 99.9, 99.99, 100} {
+		want := samples[int(math.Ceil(p/100*float64(len(samples))))-1]
+		got := h.Percentile(p)
+
+		if got < want || got > h.Max() {
+			t.Errorf("p%v = %v, want at least %v and at most max %v", p, got, want, h.Max())
+		}
+
+		if err := float64(got-want) / float64(want); err >= maxRelativeError {
+			t.Errorf("p%v = %v, want %v within %v, off by %.4f", p, got, want, maxRelativeError, err)
+		}
+	}
+
+	if got := h.Percentile(0); got != h.Min() {
+		t.Errorf("p0 = %v, want min %v", got, h.Min())
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	var h Histogram
+
+	if h.Count() != 0 || h.Mean() != 0 || h.Percentile(50) != 0 || h.Percentiles() != (Percentiles{}) {
+		t.Errorf("empty histogram: count %d, mean %v, percentiles %+v", h.Count(), h.Mean(), h.Percentiles())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var all, low, high Histogram
+
+	for i := 1; i <= 1000; i++ {
+		d := time.Duration(i) * time.Microsecond
+
+		all.Record(d)
+
+		if i%3 == 0 {
+			high.Record(d)
+		} else {
+			low.Record(d)
+		}
+	}
+
+	var merged Histogram
+	merged.Merge(&low)
+	merged.Merge(&Histogram{})
+	merged.Merge(&high)
+
+	if merged.Count() != all.Count() || merged.Mean() != all.Mean() || merged.Percentiles() != all.Percentiles() {
+		t.Errorf("merged count %d, mean %v, percentiles %+v, want %d, %v, %+v", merged.Count(), merged.Mean(),
+			merged.Percentiles(), all.Count(), all.Mean(), all.Percentiles())
+	}
+}
@@ -0,0 +1,435 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iam-performance-test/db"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidLoad = errors.New("invalid load")
+
+// idleInterval is how long an inactive closed-loop worker waits before checking the target again.
+const idleInterval = 10 * time.Millisecond
+
+// loadMaxSamples is the number of latency samples kept per scenario of a load run. Long runs issue millions of
+// queries, whose percentiles the histograms hold anyway, while reports and comparisons only need a uniform sample.
+const loadMaxSamples = 10_000
+
+// Load configures a load run issuing queries of scenarios mixed by their weights.
+//
+// Closed-loop, each active worker issues its next query as soon as the previous one completes, and stage targets are
+// the numbers of active workers. Open-loop, queries arrive at the stage target rate in queries per second regardless
+// of how fast they complete; Workers is then the maximum number of queries in flight and arrivals finding all workers
+// busy queue up to Workers deep and are dropped beyond that. Open-loop latencies are measured from the scheduled
+// arrival, so they include the queueing delay.
+type Load struct {
+	Scenarios    []Scenario
+	Workers      int
+	OpenLoop     bool
+	Stages       []Stage
+	Window       time.Duration
+	QueryTimeout time.Duration
+}
+
+// Stage ramps the load target linearly from the previous stage target, or zero for the first stage, to Target over
+// Duration.
+type Stage struct {
+	Duration time.Duration
+	Target   float64
+}
+
+// LoadResult is the outcome of a load run.
+type LoadResult struct {
+	// Scenarios are the per-scenario totals in the order of Load.Scenarios.
+	Scenarios []*Summary
+	// Windows split the run into consecutive Load.Window long intervals.
+	Windows []*Window
+	// Dropped is the number of open-loop arrivals not issued because the queue was full.
+	Dropped int
+	Elapsed time.Duration
+}
+
+// Window is the outcome of all scenarios in a time interval of a load run.
+type Window struct {
+	// Start and End are offsets from the run start.
+	Start, End time.Duration
+	// Target is the load target at the end of the window.
+	Target    float64
+	Succeeded int
+	Errors    int
+	Latency   Histogram
+}
+
+// ParseStages parses comma-separated stages written as duration:target, e.g. "30s:100,2m:100".
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: stage %q is not duration:target", ErrInvalidLoad, part)
+		}
+
+		duration, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: stage %q: %v", ErrInvalidLoad, part, err)
+		}
+
+		target, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: stage %q: %v", ErrInvalidLoad, part, err)
+		}
+
+		stages = append(stages, Stage{Duration: duration, Target: target})
+	}
+
+	return stages, nil
+}
+
+// String returns the stages in the ParseStages format.
+func (s Stage) String() string {
+	return s.Duration.String() + ":" + strconv.FormatFloat(s.Target, 'f', -1, 64)
+}
+
+// Duration returns the total duration of all stages.
+func (l *Load) Duration() time.Duration {
+	var res time.Duration
+	for _, stage := range l.Stages {
+		res += stage.Duration
+	}
+
+	return res
+}
+
+// Target returns the load target at the offset from the run start.
+func (l *Load) Target(offset time.Duration) float64 {
+	var from float64
+
+	for _, stage := range l.Stages {
+		if offset < stage.Duration {
+			return from + (stage.Target-from)*float64(offset)/float64(stage.Duration)
+		}
+
+		offset -= stage.Duration
+		from = stage.Target
+	}
+
+	return from
+}
+
+// Validate returns an ErrInvalidLoad or ErrInvalidScenario-wrapping error describing the first invalid setting.
+func (l *Load) Validate() error {
+	_, err := l.compile()
+
+	return err
+}
+
+// RunLoad runs the load against the store until all stages complete or ctx is done.
+func RunLoad(ctx context.Context, store db.StatementStore, load *Load) (*LoadResult, error) {
+	queries, err := load.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	c := newLoadCollector(load)
+	mix := newScenarioMix(load.Scenarios)
+
+	ctx, cancel := context.WithTimeout(ctx, load.Duration())
+	defer cancel()
+
+	issue := func(i int, scheduled time.Time) {
+		result, err := queries[i](ctx, store, load.QueryTimeout)
+		if err != nil && ctx.Err() != nil {
+			// The run ended while the query was in flight
+			return
+		}
+
+		c.add(i, scheduled, result, time.Since(scheduled), err)
+	}
+
+	if load.OpenLoop {
+		c.dropped = runOpenLoop(ctx, load, mix, issue)
+	} else {
+		runClosedLoop(ctx, load, mix, issue)
+	}
+
+	return c.result(), nil
+}
+
+// arrivalOffset returns the offset from the run start of the n-th open-loop arrival, at which the integral of the
+// target rate reaches n, or false if the stages end before that.
+func (l *Load) arrivalOffset(n float64) (time.Duration, bool) {
+	var from float64
+	var offset time.Duration
+
+	for _, stage := range l.Stages {
+		duration := stage.Duration.Seconds()
+
+		if area := (from + stage.Target) / 2 * duration; n > area {
+			n -= area
+			offset += stage.Duration
+			from = stage.Target
+
+			continue
+		}
+
+		// Solve from*t + a*t^2/2 = n for the rate ramping by a per second
+		var t float64
+		if a := (stage.Target - from) / duration; a == 0 {
+			t = n / from
+		} else {
+			t = (math.Sqrt(from*from+2*a*n) - from) / a
+		}
+
+		return offset + time.Duration(t*float64(time.Second)), true
+	}
+
+	return 0, false
+}
+
+// timedQuery runs a scenario query with a timeout.
+type timedQuery func(ctx context.Context, store db.StatementStore, timeout time.Duration) (Result, error)
+
+func (l *Load) compile() ([]timedQuery, error) {
+	switch {
+	case len(l.Scenarios) == 0:
+		return nil, fmt.Errorf("%w: at least one scenario is required", ErrInvalidLoad)
+	case l.Workers < 1:
+		return nil, fmt.Errorf("%w: workers must be positive", ErrInvalidLoad)
+	case len(l.Stages) == 0:
+		return nil, fmt.Errorf("%w: at least one stage is required", ErrInvalidLoad)
+	case l.Window <= 0:
+		return nil, fmt.Errorf("%w: window must be positive", ErrInvalidLoad)
+	case l.QueryTimeout <= 0:
+		return nil, fmt.Errorf("%w: query timeout must be positive", ErrInvalidLoad)
+	}
+
+	for _, stage := range l.Stages {
+		switch {
+		case stage.Duration <= 0:
+			return nil, fmt.Errorf("%w: stage %s: duration must be positive", ErrInvalidLoad, stage)
+		case stage.Target < 0:
+			return nil, fmt.Errorf("%w: stage %s: target must not be negative", ErrInvalidLoad, stage)
+		case !l.OpenLoop && stage.Target > float64(l.Workers):
+			return nil, fmt.Errorf("%w: stage %s: closed-loop target exceeds %d workers", ErrInvalidLoad, stage, l.Workers)
+		}
+	}
+
+	queries := make([]timedQuery, len(l.Scenarios))
+
+	for i := range l.Scenarios {
+		q, err := l.Scenarios[i].compile()
+		if err != nil {
+			return nil, err
+		}
+
+		queries[i] = func(ctx context.Context, store db.StatementStore, timeout time.Duration) (Result, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			return q(ctx, store)
+		}
+	}
+
+	return queries, nil
+}
+
+// runClosedLoop runs Workers workers, each issuing queries back to back while its index is below the current target.
+func runClosedLoop(ctx context.Context, load *Load, mix *scenarioMix, issue func(i int, scheduled time.Time)) {
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	for w := 0; w < load.Workers; w++ {
+		wg.Add(1)
+
+		go func(w int, rng *rand.Rand) {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				if float64(w) >= math.Round(load.Target(time.Since(start))) {
+					sleep(ctx, idleInterval)
+					continue
+				}
+
+				issue(mix.pick(rng), time.Now())
+			}
+		}(w, rand.New(rand.NewSource(time.Now().UnixNano()+int64(w))))
+	}
+
+	wg.Wait()
+}
+
+// runOpenLoop schedules arrivals at the target rate onto Workers workers and returns the number of dropped arrivals.
+func runOpenLoop(ctx context.Context, load *Load, mix *scenarioMix, issue func(i int, scheduled time.Time)) int {
+	type arrival struct {
+		scenario  int
+		scheduled time.Time
+	}
+
+	var wg sync.WaitGroup
+
+	arrivals := make(chan arrival, load.Workers)
+
+	for w := 0; w < load.Workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for a := range arrivals {
+				if ctx.Err() == nil {
+					issue(a.scenario, a.scheduled)
+				}
+			}
+		}()
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	start := time.Now()
+	dropped := 0
+
+	for n := 1; ctx.Err() == nil; n++ {
+		offset, ok := load.arrivalOffset(float64(n))
+		if !ok {
+			break
+		}
+
+		next := start.Add(offset)
+		sleep(ctx, time.Until(next))
+
+		select {
+		case arrivals <- arrival{scenario: mix.pick(rng), scheduled: next}:
+		default:
+			dropped++
+		}
+	}
+
+	close(arrivals)
+	wg.Wait()
+
+	return dropped
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// scenarioMix picks scenarios at random in proportion to their weights.
+type scenarioMix struct {
+	cumulative []int
+}
+
+func newScenarioMix(scenarios []Scenario) *scenarioMix {
+	m := &scenarioMix{cumulative: make([]int, len(scenarios))}
+
+	total := 0
+	for i := range scenarios {
+		total += scenarios[i].weight()
+		m.cumulative[i] = total
+	}
+
+	return m
+}
+
+func (m *scenarioMix) pick(rng *rand.Rand) int {
+	n := rng.Intn(m.cumulative[len(m.cumulative)-1])
+
+	for i, c := range m.cumulative {
+		if n < c {
+			return i
+		}
+	}
+
+	return len(m.cumulative) - 1
+}
+
+// loadCollector accumulates query outcomes per scenario and per window.
+type loadCollector struct {
+	mu        sync.Mutex
+	load      *Load
+	start     time.Time
+	scenarios []*Summary
+	windows   []*Window
+	dropped   int
+}
+
+func newLoadCollector(load *Load) *loadCollector {
+	c := &loadCollector{load: load, start: time.Now(), scenarios: make([]*Summary, len(load.Scenarios))}
+
+	for i := range load.Scenarios {
+		c.scenarios[i] = &Summary{Scenario: load.Scenarios[i].Name, Kind: load.Scenarios[i].Kind, Concurrency: load.Workers,
+			maxSamples: loadMaxSamples, rng: rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))}
+	}
+
+	return c
+}
+
+func (c *loadCollector) add(i int, scheduled time.Time, result Result, latency time.Duration, err error) {
+	w := int(scheduled.Sub(c.start) / c.load.Window)
+	if last := int((c.load.Duration() - 1) / c.load.Window); w > last {
+		// Queries issued just before the run ended belong to the last window
+		w = last
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.windows) <= w {
+		start := time.Duration(len(c.windows)) * c.load.Window
+		c.windows = append(c.windows, &Window{Start: start, End: start + c.load.Window, Target: c.load.Target(start + c.load.Window)})
+	}
+
+	c.scenarios[i].add(&c.load.Scenarios[i], result, latency, err)
+	c.scenarios[i].Iterations++
+
+	if err != nil {
+		c.windows[w].Errors++
+	} else {
+		c.windows[w].Succeeded++
+		c.windows[w].Latency.Record(latency)
+	}
+}
+
+func (c *loadCollector) result() *LoadResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := time.Since(c.start)
+
+	for _, s := range c.scenarios {
+		s.Elapsed = elapsed
+	}
+
+	if n := len(c.windows); n > 0 && c.windows[n-1].End > elapsed {
+		c.windows[n-1].End = elapsed
+	}
+
+	return &LoadResult{Scenarios: c.scenarios, Windows: c.windows, Dropped: c.dropped, Elapsed: elapsed}
+}
+
+// Throughput returns the number of queries per second completed in the window.
+func (w *Window) Throughput() float64 {
+	if w.End <= w.Start {
+		return 0
+	}
+
+	return float64(w.Succeeded+w.Errors) / (w.End - w.Start).Seconds()
+}
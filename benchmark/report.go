@@ -0,0 +1,439 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/db"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported report format")
+
+// Report formats.
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// Report is the machine-readable outcome of a benchmark run. Durations are in nanoseconds.
+type Report struct {
+	Metadata  Metadata         `json:"metadata"`
+	Scenarios []ScenarioReport `json:"scenarios"`
+	// Windows are the load mode time windows.
+	Windows []WindowReport `json:"windows,omitempty"`
+	// Dropped is the number of dropped open-loop arrivals.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// Metadata describes the environment of a benchmark run.
+type Metadata struct {
+	Mode            string         `json:"mode"`
+	StartedAt       time.Time      `json:"startedAt"`
+	Backend         string         `json:"backend"`
+	Dataset         config.Dataset `json:"dataset"`
+	GoVersion       string         `json:"goVersion"`
+	DatabaseVersion string         `json:"databaseVersion,omitempty"`
+	GitCommit       string         `json:"gitCommit,omitempty"`
+	// Schemas are the storage schemas benchmarked side by side, if several.
+	Schemas []string `json:"schemas,omitempty"`
+}
+
+// ScenarioReport is the outcome of a scenario in a Report.
+type ScenarioReport struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Schema is the storage schema the scenario ran against, if several schemas were benchmarked side by side.
+	Schema      string        `json:"schema,omitempty"`
+	Warmup      int           `json:"warmup"`
+	Iterations  int           `json:"iterations"`
+	Concurrency int           `json:"concurrency"`
+	Succeeded   int           `json:"succeeded"`
+	Errors      int           `json:"errors"`
+	Unexpected  int           `json:"unexpected"`
+	Elapsed     time.Duration `json:"elapsed"`
+	Throughput  float64       `json:"throughput"`
+	Mean        time.Duration `json:"mean"`
+	Percentiles Percentiles   `json:"percentiles"`
+	// Samples are the latencies of successful queries, of load runs a uniform sample of at most 10k per scenario.
+	Samples []time.Duration `json:"samples"`
+	// Plans are the executed plans of the scenario queries when captured.
+	Plans []db.QueryPlan `json:"plans,omitempty"`
+	// RowsPerWrite is the mean number of table rows written by a statement write of the writes mode as counted by
+	// PostgreSQL, triggers included.
+	RowsPerWrite float64 `json:"rowsPerWrite,omitempty"`
+}
+
+// WindowReport is a load mode time window in a Report.
+type WindowReport struct {
+	Start       time.Duration `json:"start"`
+	End         time.Duration `json:"end"`
+	Target      float64       `json:"target"`
+	Succeeded   int           `json:"succeeded"`
+	Errors      int           `json:"errors"`
+	Throughput  float64       `json:"throughput"`
+	Percentiles Percentiles   `json:"percentiles"`
+}
+
+// NewMetadata returns the metadata of a run starting now, detecting the Go version and the git commit.
+// The database version is left for the caller to fill in.
+func NewMetadata(mode, backend string, dataset config.Dataset) Metadata {
+	return Metadata{
+		Mode:      mode,
+		StartedAt: time.Now().UTC(),
+		Backend:   backend,
+		Dataset:   dataset,
+		GoVersion: runtime.Version(),
+		GitCommit: gitCommit(),
+	}
+}
+
+// NewReport builds a report of scenario summaries.
+func NewReport(metadata Metadata, summaries []*Summary) *Report {
+	r := &Report{Metadata: metadata, Scenarios: make([]ScenarioReport, 0, len(summaries))}
+
+	for _, s := range summaries {
+		r.Scenarios = append(r.Scenarios, ScenarioReport{
+			Name:         s.Scenario,
+			Kind:         s.Kind,
+			Schema:       s.Schema,
+			Warmup:       s.Warmup,
+			Iterations:   s.Iterations,
+			Concurrency:  s.Concurrency,
+			Succeeded:    s.Succeeded,
+			Errors:       s.Errors,
+			Unexpected:   s.Unexpected,
+			Elapsed:      s.Elapsed,
+			Throughput:   s.Throughput(),
+			Mean:         s.Latency.Mean(),
+			Percentiles:  s.Latency.Percentiles(),
+			Samples:      s.Samples,
+			Plans:        s.Plans,
+			RowsPerWrite: s.RowsPerWrite(),
+		})
+	}
+
+	return r
+}
+
+// Label returns the scenario name followed by its schema, if any, e.g. "case-1 [jsonb]". Labels identify scenarios
+// across reports.
+func (s *ScenarioReport) Label() string {
+	if s.Schema == "" {
+		return s.Name
+	}
+
+	return s.Name + " [" + s.Schema + "]"
+}
+
+// NewLoadReport builds a report of a load run.
+func NewLoadReport(metadata Metadata, res *LoadResult) *Report {
+	r := NewReport(metadata, res.Scenarios)
+	r.Dropped = res.Dropped
+
+	for _, w := range res.Windows {
+		r.Windows = append(r.Windows, WindowReport{
+			Start:       w.Start,
+			End:         w.End,
+			Target:      w.Target,
+			Succeeded:   w.Succeeded,
+			Errors:      w.Errors,
+			Throughput:  w.Throughput(),
+			Percentiles: w.Latency.Percentiles(),
+		})
+	}
+
+	return r
+}
+
+// ReadReport reads a JSON report.
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Report
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return &r, nil
+}
+
+// FormatOf returns the report format of a file extension: .json, .csv or .md.
+func FormatOf(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return FormatJSON, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".md":
+		return FormatMarkdown, nil
+	default:
+		return "", fmt.Errorf("%w: file extension %q", ErrUnsupportedFormat, ext)
+	}
+}
+
+// WriteFile writes the report in the format of the file extension, creating missing directories.
+func (r *Report) WriteFile(path string) (err error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return r.Write(f, format)
+}
+
+// Write renders the report in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatCSV:
+		return r.WriteCSV(w)
+	case FormatMarkdown:
+		return r.WriteMarkdown(w)
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// WriteJSON renders the complete report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// WriteCSV renders a row per scenario with the run metadata repeated on every row. Latencies are in milliseconds.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"scenario", "kind", "schema", "mode", "backend", "services", "statements", "resources", "principals", "seed",
+		"git_commit", "warmup", "iterations", "concurrency", "succeeded", "errors", "unexpected", "throughput_qps",
+		"mean_ms", "min_ms", "p50_ms", "p90_ms", "p99_ms", "p999_ms", "max_ms"}
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	m := r.Metadata
+
+	for _, s := range r.Scenarios {
+		p := s.Percentiles
+
+		row := []string{s.Name, s.Kind, s.Schema, m.Mode, m.Backend, strconv.Itoa(m.Dataset.ServiceCount), strconv.Itoa(m.Dataset.StatementCount),
+			strconv.Itoa(m.Dataset.ResourceCount), strconv.Itoa(m.Dataset.PrincipalCount), strconv.FormatInt(m.Dataset.Seed, 10),
+			m.GitCommit, strconv.Itoa(s.Warmup), strconv.Itoa(s.Iterations), strconv.Itoa(s.Concurrency), strconv.Itoa(s.Succeeded), strconv.Itoa(s.Errors),
+			strconv.Itoa(s.Unexpected), strconv.FormatFloat(s.Throughput, 'f', 1, 64),
+			milliseconds(s.Mean), milliseconds(p.Min), milliseconds(p.P50), milliseconds(p.P90), milliseconds(p.P99),
+			milliseconds(p.P999), milliseconds(p.Max)}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteMarkdown renders the metadata and tables of scenarios and load windows, along with a side-by-side table of the
+// schemas if several were benchmarked and a table of the rows written per write if writes were measured. Latencies are
+// in milliseconds.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	m := r.Metadata
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "## Benchmark %s, %s\n\n", m.Mode, m.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(b, "- Backend: %s\n", strings.TrimSpace(m.Backend+" "+m.DatabaseVersion))
+	if len(m.Schemas) > 0 {
+		fmt.Fprintf(b, "- Schemas: %s\n", strings.Join(m.Schemas, ", "))
+	}
+
+	fmt.Fprintf(b, "- Dataset: %d services × %d statements, %d resources and %d principals per statement, seed %d\n",
+		m.Dataset.ServiceCount, m.Dataset.StatementCount, m.Dataset.ResourceCount, m.Dataset.PrincipalCount, m.Dataset.Seed)
+	fmt.Fprintf(b, "- Go: %s\n", m.GoVersion)
+
+	if m.GitCommit != "" {
+		fmt.Fprintf(b, "- Commit: %s\n", m.GitCommit)
+	}
+
+	b.WriteString("\n| Scenario | Kind | Iterations | Errors | Throughput (q/s) | Mean | Min | p50 | p90 | p99 | p99.9 | Max |\n")
+	b.WriteString("|---|---|--:|--:|--:|--:|--:|--:|--:|--:|--:|--:|\n")
+
+	for _, s := range r.Scenarios {
+		p := s.Percentiles
+		fmt.Fprintf(b, "| %s | %s | %d | %d | %.1f | %s | %s | %s | %s | %s | %s | %s |\n",
+			s.Label(), s.Kind, s.Succeeded+s.Errors, s.Errors, s.Throughput, milliseconds(s.Mean),
+			milliseconds(p.Min), milliseconds(p.P50), milliseconds(p.P90), milliseconds(p.P99), milliseconds(p.P999), milliseconds(p.Max))
+	}
+
+	r.writeSchemas(b)
+	r.writeAmplification(b)
+	r.writePlans(b)
+
+	if len(r.Windows) > 0 {
+		b.WriteString("\n| Window | Target | Throughput (q/s) | Errors | p50 | p90 | p99 | Max |\n")
+		b.WriteString("|---|--:|--:|--:|--:|--:|--:|--:|\n")
+
+		for _, win := range r.Windows {
+			p := win.Percentiles
+			fmt.Fprintf(b, "| %s–%s | %.1f | %.1f | %d | %s | %s | %s | %s |\n",
+				win.Start, win.End, win.Target, win.Throughput, win.Errors,
+				milliseconds(p.P50), milliseconds(p.P90), milliseconds(p.P99), milliseconds(p.Max))
+		}
+	}
+
+	if r.Dropped > 0 {
+		fmt.Fprintf(b, "\nDropped open-loop arrivals: %d\n", r.Dropped)
+	}
+
+	b.WriteString("\nLatencies are in milliseconds.\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// writeSchemas renders a table comparing the p50 and p99 latencies of every scenario across the Metadata.Schemas, if
+// several were benchmarked.
+func (r *Report) writeSchemas(b *strings.Builder) {
+	schemas := r.Metadata.Schemas
+	if len(schemas) < 2 {
+		return
+	}
+
+	var names []string
+
+	scenarios := make(map[string]map[string]*ScenarioReport)
+
+	for i := range r.Scenarios {
+		s := &r.Scenarios[i]
+
+		if scenarios[s.Name] == nil {
+			scenarios[s.Name] = make(map[string]*ScenarioReport, len(schemas))
+			names = append(names, s.Name)
+		}
+
+		scenarios[s.Name][s.Schema] = s
+	}
+
+	b.WriteString("\n| Scenario |")
+
+	for _, schema := range schemas {
+		fmt.Fprintf(b, " %s p50 | %s p99 |", schema, schema)
+	}
+
+	b.WriteString("\n|---|" + strings.Repeat("--:|--:|", len(schemas)) + "\n")
+
+	for _, name := range names {
+		b.WriteString("| " + name + " |")
+
+		for _, schema := range schemas {
+			s, ok := scenarios[name][schema]
+			if !ok || s.Succeeded == 0 {
+				b.WriteString(" – | – |")
+				continue
+			}
+
+			fmt.Fprintf(b, " %s | %s |", milliseconds(s.Percentiles.P50), milliseconds(s.Percentiles.P99))
+		}
+
+		b.WriteString("\n")
+	}
+}
+
+// writeAmplification renders a table of the rows written per statement write, if any writes were counted.
+func (r *Report) writeAmplification(b *strings.Builder) {
+	header := false
+
+	for _, s := range r.Scenarios {
+		if s.RowsPerWrite == 0 {
+			continue
+		}
+
+		if !header {
+			b.WriteString("\n| Scenario | Writes | Rows per write | p50 | p99 |\n")
+			b.WriteString("|---|--:|--:|--:|--:|\n")
+
+			header = true
+		}
+
+		fmt.Fprintf(b, "| %s | %d | %.1f | %s | %s |\n", s.Label(), s.Succeeded, s.RowsPerWrite,
+			milliseconds(s.Percentiles.P50), milliseconds(s.Percentiles.P99))
+	}
+}
+
+// writePlans renders a table of the facts of the captured query plans, if any.
+func (r *Report) writePlans(b *strings.Builder) {
+	header := false
+
+	for _, s := range r.Scenarios {
+		for i, plan := range s.Plans {
+			if !header {
+				b.WriteString("\n| Scenario | Query | Indexes | Seq scans | Est. rows | Actual rows | Shared hit | Shared read | Execution |\n")
+				b.WriteString("|---|--:|---|---|--:|--:|--:|--:|--:|\n")
+
+				header = true
+			}
+
+			f := plan.Facts
+			fmt.Fprintf(b, "| %s | %d | %s | %s | %.0f | %.0f | %d | %d | %.3f |\n", s.Label(), i+1,
+				strings.Join(f.Indexes, ", "), strings.Join(f.SeqScans, ", "), f.EstimatedRows, f.ActualRows,
+				f.SharedHitBlocks, f.SharedReadBlocks, f.ExecutionTime)
+		}
+	}
+}
+
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// gitCommit returns the commit the binary was built from, or the commit checked out in the working directory when
+// running with go run, or an empty string.
+func gitCommit() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
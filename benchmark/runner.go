@@ -0,0 +1,194 @@
+package benchmark
+
+import (
+	"context"
+	"iam-performance-test/db"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Summary is the outcome of running all measured iterations of a Scenario.
+type Summary struct {
+	Scenario string
+	Kind     string
+	// Schema is the storage schema the scenario ran against when several schemas are benchmarked side by side.
+	Schema      string
+	Warmup      int
+	Iterations  int
+	Concurrency int
+	// Succeeded is the number of successful queries.
+	Succeeded int
+	// Errors is the number of failed queries, and Err is the first failure.
+	Errors int
+	Err    error
+	// Unexpected is the number of results not meeting the scenario expectation, and Mismatch is the first mismatch.
+	Unexpected int
+	Mismatch   error
+	// Last is the result of a successful query.
+	Last Result
+	// Latency holds the latencies of successful queries, and Samples lists them in completion order per worker, or
+	// with maxSamples set, a uniform random sample of at most maxSamples of them.
+	Latency Histogram
+	Samples []time.Duration
+	// Elapsed is the wall-clock time of the measured iterations.
+	Elapsed time.Duration
+	// Plans are the executed plans of the scenario queries when captured, see Scenario.Queries.
+	Plans []db.QueryPlan
+	// Rows is the number of table rows written by successful writes, see RunWrites.
+	Rows int64
+
+	// maxSamples bounds Samples when not 0, replacing samples at random as drawn by rng.
+	maxSamples int
+	rng        *rand.Rand
+}
+
+// Run validates the scenario, runs its warmup iterations and then its measured iterations against the store, each
+// query with the given timeout. Warmup results are discarded. Query failures are counted in the Summary rather than
+// stopping the run.
+func Run(ctx context.Context, store db.StatementStore, scenario *Scenario, queryTimeout time.Duration) (*Summary, error) {
+	q, err := scenario.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := orDefault(scenario.Concurrency)
+
+	runIterations(ctx, store, scenario, q, queryTimeout, scenario.Warmup, concurrency)
+
+	start := time.Now()
+
+	res := runIterations(ctx, store, scenario, q, queryTimeout, orDefault(scenario.Iterations), concurrency)
+	res.Elapsed = time.Since(start)
+	res.Warmup = scenario.Warmup
+
+	return res, nil
+}
+
+// runIterations runs the query the given number of times using concurrency workers until ctx is done.
+func runIterations(ctx context.Context, store db.StatementStore, scenario *Scenario, q query, queryTimeout time.Duration,
+	iterations, concurrency int) *Summary {
+	res := &Summary{Scenario: scenario.Name, Kind: scenario.Kind, Iterations: iterations, Concurrency: concurrency}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan struct{})
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			worker := &Summary{}
+			for range jobs {
+				result, latency, err := runQuery(ctx, store, q, queryTimeout)
+				worker.add(scenario, result, latency, err)
+			}
+
+			mu.Lock()
+			res.merge(worker)
+			mu.Unlock()
+		}()
+	}
+
+feed:
+	for i := 0; i < iterations; i++ {
+		select {
+		case jobs <- struct{}{}:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return res
+}
+
+func runQuery(ctx context.Context, store db.StatementStore, q query, timeout time.Duration) (Result, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := q(ctx, store)
+
+	return result, time.Since(start), err
+}
+
+// Completed returns the number of measured queries that ran, which is less than Iterations after a cancellation.
+func (s *Summary) Completed() int { return s.Succeeded + s.Errors }
+
+// Throughput returns the number of measured queries per second.
+func (s *Summary) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Completed()) / s.Elapsed.Seconds()
+}
+
+func (s *Summary) add(scenario *Scenario, result Result, latency time.Duration, err error) {
+	if err != nil {
+		if s.Errors++; s.Err == nil {
+			s.Err = err
+		}
+
+		return
+	}
+
+	s.Latency.Record(latency)
+	s.sample(latency)
+	s.Last = result
+	s.Succeeded++
+
+	if err = scenario.check(result); err != nil {
+		if s.Unexpected++; s.Mismatch == nil {
+			s.Mismatch = err
+		}
+	}
+}
+
+// sample adds the latency of a successful query to Samples. Once maxSamples are kept, the latency replaces a random
+// sample with a probability of maxSamples over the number of successful queries, which keeps a uniform sample of all
+// of them (reservoir sampling).
+func (s *Summary) sample(latency time.Duration) {
+	if s.maxSamples == 0 || len(s.Samples) < s.maxSamples {
+		s.Samples = append(s.Samples, latency)
+		return
+	}
+
+	// Succeeded does not count this query yet
+	if i := s.rng.Intn(s.Succeeded + 1); i < s.maxSamples {
+		s.Samples[i] = latency
+	}
+}
+
+func (s *Summary) merge(o *Summary) {
+	s.Latency.Merge(&o.Latency)
+	s.Samples = append(s.Samples, o.Samples...)
+
+	if o.Succeeded > 0 {
+		s.Last = o.Last
+	}
+
+	s.Succeeded += o.Succeeded
+
+	if s.Errors += o.Errors; s.Err == nil {
+		s.Err = o.Err
+	}
+
+	if s.Unexpected += o.Unexpected; s.Mismatch == nil {
+		s.Mismatch = o.Mismatch
+	}
+}
+
+func orDefault(n int) int {
+	if n == 0 {
+		return 1
+	}
+
+	return n
+}
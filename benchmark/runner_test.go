@@ -0,0 +1,52 @@
+package benchmark
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSummarySampleBounded(t *testing.T) {
+	const queries, maxSamples = 100_000, 1_000
+
+	s := &Summary{maxSamples: maxSamples, rng: rand.New(rand.NewSource(1))}
+
+	for i := 0; i < queries; i++ {
+		s.add(writeScenario, Result{}, time.Duration(i), nil)
+	}
+
+	if len(s.Samples) != maxSamples || s.Succeeded != queries || s.Latency.Count() != queries {
+		t.Fatalf("got %d samples of %d queries, histogram %d, want %d of %d", len(s.Samples), s.Succeeded,
+			s.Latency.Count(), maxSamples, queries)
+	}
+
+	// A uniform sample has as many samples of the later half of the queries as of the earlier one
+	later := 0
+	for _, sample := range s.Samples {
+		if sample >= queries/2 {
+			later++
+		}
+	}
+
+	if later < maxSamples*45/100 || later > maxSamples*55/100 {
+		t.Errorf("%d of %d samples are of the later half of the queries", later, maxSamples)
+	}
+}
+
+func TestSummarySampleUnbounded(t *testing.T) {
+	s := &Summary{}
+
+	for i := 0; i < 100; i++ {
+		s.add(writeScenario, Result{}, time.Duration(i), nil)
+	}
+
+	for i, sample := range s.Samples {
+		if sample != time.Duration(i) {
+			t.Fatalf("sample %d is %v, want every latency in order", i, sample)
+		}
+	}
+
+	if len(s.Samples) != 100 {
+		t.Errorf("got %d samples, want 100", len(s.Samples))
+	}
+}
@@ -0,0 +1,464 @@
+package benchmark
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iam-performance-test/db"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// Query kinds of a Scenario.
+const (
+	// KindExists checks whether any statement matches. The result count is 1 or 0.
+	KindExists = "exists"
+	// KindEvaluate evaluates a single resource with deny-overrides semantics.
+	KindEvaluate = "evaluate"
+	// KindExplain evaluates a single resource reporting the matching statements, which are the result count.
+	KindExplain = "explain"
+	// KindSearchResources searches resources of matching statements. The result count is the number of resources.
+	KindSearchResources = "search-resources"
+	// KindGroupByType searches resources of matching statements grouped into allowed and denied ones.
+	// The result count is the number of resources in both groups.
+	KindGroupByType = "group-by-type"
+	// KindBatchEvaluate evaluates every resource in a single batch. The result count is the number of allowed resources.
+	KindBatchEvaluate = "batch-evaluate"
+	// KindExistsEach checks every resource with an exists query of its own, the one round trip per resource
+	// counterpart of batch-evaluate. The result count is the number of resources with a matching statement.
+	KindExistsEach = "exists-each"
+	// KindWhoHasAccess lists principals who have access to a single resource. The principal is not used.
+	// The result count is the number of effective principal patterns.
+	KindWhoHasAccess = "who-has-access"
+)
+
+// Scenario is a benchmark query defined as data.
+//
+// Resources of the exists, exists-each, search-resources and group-by-type kinds are expanded to all their matching
+// KRNs, so a wildcard resource searches everything below it.
+type Scenario struct {
+	Name        string   `json:"name"                  yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Kind        string   `json:"kind"                  yaml:"kind"`
+	Action      string   `json:"action"                yaml:"action"`
+	Principal   string   `json:"principal,omitempty"   yaml:"principal,omitempty"`
+	Resources   []string `json:"resources"             yaml:"resources"`
+	// Expect is checked against the result of every iteration when set.
+	Expect Expectation `json:"expect,omitempty" yaml:"expect,omitempty"`
+	// Warmup is the number of unmeasured queries run before the measured iterations.
+	Warmup int `json:"warmup,omitempty" yaml:"warmup,omitempty"`
+	// Iterations is the number of measured queries, 1 by default.
+	Iterations int `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+	// Concurrency is the number of queries running at once, 1 by default.
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	// Weight is the relative frequency of the scenario queries in load runs, 1 by default.
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Expectation is the expected result of a Scenario. Empty fields are not checked.
+type Expectation struct {
+	Count *int `json:"count,omitempty" yaml:"count,omitempty"`
+	// Decision is the expected db.Decision name of the evaluate and explain kinds, e.g. "ExplicitDeny".
+	Decision string `json:"decision,omitempty" yaml:"decision,omitempty"`
+}
+
+// Result is the outcome of a single Scenario query.
+type Result struct {
+	Count    int
+	Decision db.Decision
+}
+
+// query runs a validated Scenario once.
+type query func(ctx context.Context, store db.StatementStore) (Result, error)
+
+// scenarioFile is the layout of scenario files.
+type scenarioFile struct {
+	Scenarios []Scenario `json:"scenarios" yaml:"scenarios"`
+}
+
+//go:embed default_scenarios.yaml
+var defaultScenarios []byte
+
+// DefaultScenarios returns the built-in scenarios.
+func DefaultScenarios() ([]Scenario, error) {
+	return parseScenarios("default_scenarios.yaml", defaultScenarios, yaml.Unmarshal)
+}
+
+// LoadScenarios reads and validates the scenarios of a YAML or JSON file.
+func LoadScenarios(path string) ([]Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return parseScenarios(path, data, yaml.Unmarshal)
+	case ".json":
+		return parseScenarios(path, data, json.Unmarshal)
+	default:
+		return nil, fmt.Errorf("%w: unsupported scenario file extension %q", ErrInvalidScenario, ext)
+	}
+}
+
+// ProbeScenarios returns an evaluate scenario per probe, named after it with a "probe-" prefix, asserting its
+// decision.
+func ProbeScenarios(probes []db.Probe) []Scenario {
+	res := make([]Scenario, len(probes))
+
+	for i, p := range probes {
+		res[i] = Scenario{
+			Name:        "probe-" + p.Name,
+			Description: "Probe " + p.Description,
+			Kind:        KindEvaluate,
+			Action:      p.Action,
+			Principal:   p.Principal,
+			Resources:   []string{p.Resource},
+			Expect:      Expectation{Decision: p.Decision.String()},
+		}
+	}
+
+	return res
+}
+
+// Select returns the scenarios with the given names in their original order, or all of them for no names.
+func Select(scenarios []Scenario, names ...string) ([]Scenario, error) {
+	if len(names) == 0 {
+		return scenarios, nil
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = false
+	}
+
+	var res []Scenario
+
+	for i := range scenarios {
+		if _, ok := selected[scenarios[i].Name]; ok {
+			selected[scenarios[i].Name] = true
+			res = append(res, scenarios[i])
+		}
+	}
+
+	for _, name := range names {
+		if !selected[name] {
+			return nil, fmt.Errorf("unknown scenario %q", name)
+		}
+	}
+
+	return res, nil
+}
+
+// Validate returns an ErrInvalidScenario-wrapping error describing the first invalid field.
+func (s *Scenario) Validate() error {
+	_, err := s.compile()
+
+	return err
+}
+
+func parseScenarios(path string, data []byte, unmarshal func([]byte, interface{}) error) ([]Scenario, error) {
+	var file scenarioFile
+
+	if err := unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: parsing %s: %v", ErrInvalidScenario, path, err)
+	}
+
+	names := make(map[string]void, len(file.Scenarios))
+
+	for i := range file.Scenarios {
+		if err := file.Scenarios[i].Validate(); err != nil {
+			return nil, fmt.Errorf("%s: scenario %d: %w", path, i+1, err)
+		}
+
+		if _, ok := names[file.Scenarios[i].Name]; ok {
+			return nil, fmt.Errorf("%w: %s: duplicate scenario %q", ErrInvalidScenario, path, file.Scenarios[i].Name)
+		}
+
+		names[file.Scenarios[i].Name] = member
+	}
+
+	return file.Scenarios, nil
+}
+
+type void struct{}
+
+var member void
+
+var kinds = map[string]void{
+	KindExists:          member,
+	KindEvaluate:        member,
+	KindExplain:         member,
+	KindSearchResources: member,
+	KindGroupByType:     member,
+	KindBatchEvaluate:   member,
+	KindExistsEach:      member,
+	KindWhoHasAccess:    member,
+}
+
+func isKind(kind string) bool {
+	_, ok := kinds[kind]
+
+	return ok
+}
+
+// compile validates the scenario and builds its query.
+func (s *Scenario) compile() (query, error) {
+	switch {
+	case s.Name == "":
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidScenario)
+	case !isKind(s.Kind):
+		return nil, fmt.Errorf("%w: %s: unknown kind %q", ErrInvalidScenario, s.Name, s.Kind)
+	case !action.Action(s.Action).IsValid():
+		return nil, fmt.Errorf("%w: %s: invalid action %q", ErrInvalidScenario, s.Name, s.Action)
+	case len(s.Resources) == 0:
+		return nil, fmt.Errorf("%w: %s: at least one resource is required", ErrInvalidScenario, s.Name)
+	case s.Warmup < 0:
+		return nil, fmt.Errorf("%w: %s: warmup must not be negative", ErrInvalidScenario, s.Name)
+	case s.Iterations < 0:
+		return nil, fmt.Errorf("%w: %s: iterations must not be negative", ErrInvalidScenario, s.Name)
+	case s.Concurrency < 0:
+		return nil, fmt.Errorf("%w: %s: concurrency must not be negative", ErrInvalidScenario, s.Name)
+	case s.Weight < 0:
+		return nil, fmt.Errorf("%w: %s: weight must not be negative", ErrInvalidScenario, s.Name)
+	case s.Expect.Count != nil && *s.Expect.Count < 0:
+		return nil, fmt.Errorf("%w: %s: expected count must not be negative", ErrInvalidScenario, s.Name)
+	}
+
+	act := action.Action(s.Action)
+
+	resources := make([]*krn.KRN, len(s.Resources))
+	for i, resource := range s.Resources {
+		k, err := krn.NewKRNFromString(resource)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: resource %q: %v", ErrInvalidScenario, s.Name, resource, err)
+		}
+
+		resources[i] = k
+	}
+
+	var principal *krn.KRN
+
+	if s.Kind != KindWhoHasAccess {
+		k, err := krn.NewKRNFromString(s.Principal)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: principal %q: %v", ErrInvalidScenario, s.Name, s.Principal, err)
+		}
+
+		principal = k
+	}
+
+	switch s.Kind {
+	case KindEvaluate, KindExplain, KindWhoHasAccess:
+		if len(resources) != 1 {
+			return nil, fmt.Errorf("%w: %s: the %s kind requires exactly one resource", ErrInvalidScenario, s.Name, s.Kind)
+		}
+	}
+
+	switch s.Expect.Decision {
+	case "":
+	case db.ImplicitDeny.String(), db.Allow.String(), db.ExplicitDeny.String():
+		if s.Kind != KindEvaluate && s.Kind != KindExplain {
+			return nil, fmt.Errorf("%w: %s: the %s kind makes no decision", ErrInvalidScenario, s.Name, s.Kind)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown decision %q", ErrInvalidScenario, s.Name, s.Expect.Decision)
+	}
+
+	switch s.Kind {
+	case KindExists:
+		request := newRequest(act, principal, resources)
+
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			isExists, err := db.ExistSearchStatementByParams(ctx, store, request)
+			if err != nil || !isExists {
+				return Result{}, err
+			}
+
+			return Result{Count: 1}, nil
+		}, nil
+	case KindEvaluate:
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			decision, err := db.Evaluate(ctx, store, principal, act, resources[0])
+
+			return Result{Decision: decision}, err
+		}, nil
+	case KindExplain:
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			explanation, err := db.Explain(ctx, store, principal, act, resources[0])
+			if err != nil {
+				return Result{}, err
+			}
+
+			return Result{Count: len(explanation.Allows) + len(explanation.Denies), Decision: explanation.Decision}, nil
+		}, nil
+	case KindSearchResources:
+		request := newRequest(act, principal, resources)
+
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			found, err := db.SearchResourcesByParams(ctx, store, request)
+
+			return Result{Count: len(found)}, err
+		}, nil
+	case KindGroupByType:
+		request := newRequest(act, principal, resources)
+
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			allowed, denied, err := db.SearchResourcesByParamsGroupingByType(ctx, store, request)
+
+			return Result{Count: len(allowed) + len(denied)}, err
+		}, nil
+	case KindBatchEvaluate:
+		tuples := make([]db.EvaluationTuple, len(resources))
+		for i := range resources {
+			tuples[i] = db.EvaluationTuple{Principal: principal, Action: act, Resource: resources[i]}
+		}
+
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			decisions, err := db.BatchEvaluate(ctx, store, tuples)
+			if err != nil {
+				return Result{}, err
+			}
+
+			res := Result{}
+			for _, decision := range decisions {
+				if decision.IsAllowed() {
+					res.Count++
+				}
+			}
+
+			return res, nil
+		}, nil
+	case KindExistsEach:
+		requests := make([]*db.EvaluatePermissionRequest, len(resources))
+		for i := range resources {
+			requests[i] = newRequest(act, principal, resources[i:i+1])
+		}
+
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			res := Result{}
+
+			for _, request := range requests {
+				isExists, err := db.ExistSearchStatementByParams(ctx, store, request)
+				if err != nil {
+					return Result{}, err
+				}
+
+				if isExists {
+					res.Count++
+				}
+			}
+
+			return res, nil
+		}, nil
+	case KindWhoHasAccess:
+		return func(ctx context.Context, store db.StatementStore) (Result, error) {
+			access, err := db.WhoHasAccess(ctx, store, act, resources[0])
+			if err != nil {
+				return Result{}, err
+			}
+
+			return Result{Count: len(access.Principals)}, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s: unknown kind %q", ErrInvalidScenario, s.Name, s.Kind)
+}
+
+// Queries returns the SQL queries a single iteration of the scenario issues against a PostgreSQL store of the
+// builder schema. The resources of the batch-evaluate kind are searched by a single query, however many they are, and
+// those of the exists-each kind by a query each.
+func (s *Scenario) Queries(builder db.QueryBuilder) ([]db.Query, error) {
+	if _, err := s.compile(); err != nil {
+		return nil, err
+	}
+
+	act := action.Action(s.Action)
+
+	resources := make([]*krn.KRN, len(s.Resources))
+	for i := range s.Resources {
+		resources[i], _ = krn.NewKRNFromString(s.Resources[i]) // Validated by compile
+	}
+
+	if s.Kind == KindWhoHasAccess {
+		allowed := &db.EvaluatePermissionRequest{Actions: act.MatchingActionsString(), Resources: resources[0].MatchingKRNs(), Type: model.Allow}
+		denied := &db.EvaluatePermissionRequest{Actions: allowed.Actions, Resources: allowed.Resources, Type: model.Deny}
+
+		return []db.Query{builder.PrincipalsQuery(allowed), builder.PrincipalsQuery(denied)}, nil
+	}
+
+	principal, _ := krn.NewKRNFromString(s.Principal)
+
+	// Evaluations search the matching KRNs of their single resource
+	evaluations := make([]*db.EvaluatePermissionRequest, len(resources))
+	for i := range resources {
+		evaluations[i] = &db.EvaluatePermissionRequest{
+			Actions:    act.MatchingActionsString(),
+			Resources:  resources[i].MatchingKRNs(),
+			Principals: principal.MatchingKRNs(),
+		}
+	}
+
+	switch s.Kind {
+	case KindExists:
+		return []db.Query{builder.ExistQuery(newRequest(act, principal, resources))}, nil
+	case KindEvaluate:
+		return []db.Query{builder.StatementTypesQuery(evaluations[0])}, nil
+	case KindExplain:
+		return []db.Query{builder.StatementsQuery(evaluations[0])}, nil
+	case KindSearchResources:
+		return []db.Query{builder.ResourcesQuery(newRequest(act, principal, resources))}, nil
+	case KindGroupByType:
+		return []db.Query{builder.ResourcesGroupingByTypeQuery(newRequest(act, principal, resources))}, nil
+	case KindBatchEvaluate:
+		return []db.Query{builder.BatchStatementTypesQuery(evaluations)}, nil
+	case KindExistsEach:
+		queries := make([]db.Query, len(resources))
+		for i := range resources {
+			queries[i] = builder.ExistQuery(newRequest(act, principal, resources[i:i+1]))
+		}
+
+		return queries, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s: unknown kind %q", ErrInvalidScenario, s.Name, s.Kind)
+}
+
+func (s *Scenario) weight() int { return orDefault(s.Weight) }
+
+// check returns an error if the result does not meet the expectation.
+func (s *Scenario) check(res Result) error {
+	if s.Expect.Count != nil && res.Count != *s.Expect.Count {
+		return fmt.Errorf("expected count %d, got %d", *s.Expect.Count, res.Count)
+	}
+
+	if s.Expect.Decision != "" && res.Decision.String() != s.Expect.Decision {
+		return fmt.Errorf("expected decision %s, got %s", s.Expect.Decision, res.Decision)
+	}
+
+	return nil
+}
+
+// newRequest builds the request matching statements for the action, the principal and any of the resources.
+func newRequest(act action.Action, principal *krn.KRN, resources []*krn.KRN) *db.EvaluatePermissionRequest {
+	krns := make([]string, len(resources))
+	for i := range resources {
+		krns[i] = resources[i].String()
+	}
+
+	return &db.EvaluatePermissionRequest{
+		Actions:    act.MatchingActionsString(),
+		Resources:  krn.NewKRNArrayFromStrings(krns...),
+		Principals: principal.MatchingKRNs(),
+	}
+}
@@ -0,0 +1,112 @@
+package benchmark
+
+import (
+	"context"
+	"iam-performance-test/db"
+	"iam-performance-test/model"
+	"time"
+)
+
+// Kinds of the summaries of RunWrites, which are not scenario kinds.
+const (
+	// KindInsert creates a single statement.
+	KindInsert = "insert"
+	// KindDelete deletes a single statement.
+	KindDelete = "delete"
+)
+
+// writeScenario is the scenario of write summaries, which expects nothing.
+var writeScenario = &Scenario{}
+
+// rowCounter is implemented by stores counting the table rows written by their writes, see
+// db.PostgresStore.CountWrites.
+type rowCounter interface {
+	CountWrites(ctx context.Context, write func(store db.StatementStore) error) (int64, error)
+}
+
+// RunWrites creates the statements one by one and then deletes the created ones again in the same order, each write
+// with the given timeout, so the store ends up unchanged unless deletes fail. It returns an insert and a delete
+// summary.
+//
+// Stores counting their writes run every write in a transaction of its own and the rows it wrote, triggers included,
+// are its result count and summed up in Summary.Rows. Their latencies include counting the rows. Other stores count no
+// rows.
+func RunWrites(ctx context.Context, store db.StatementStore, statements []*model.Statement, timeout time.Duration) []*Summary {
+	inserts := &Summary{Scenario: KindInsert, Kind: KindInsert, Iterations: len(statements), Concurrency: 1}
+	created := make([]*model.Statement, 0, len(statements))
+
+	start := time.Now()
+
+	for _, statement := range statements {
+		if ctx.Err() != nil {
+			break
+		}
+
+		rows, latency, err := runWrite(ctx, store, timeout, func(ctx context.Context, store db.StatementStore) error {
+			return store.Create(ctx, []*model.Statement{statement})
+		})
+
+		if inserts.addWrite(rows, latency, err) {
+			created = append(created, statement)
+		}
+	}
+
+	inserts.Elapsed = time.Since(start)
+
+	deletes := &Summary{Scenario: KindDelete, Kind: KindDelete, Iterations: len(created), Concurrency: 1}
+
+	start = time.Now()
+
+	for _, statement := range created {
+		rows, latency, err := runWrite(ctx, store, timeout, func(ctx context.Context, store db.StatementStore) error {
+			return store.Delete(ctx, statement.ID)
+		})
+
+		deletes.addWrite(rows, latency, err)
+	}
+
+	deletes.Elapsed = time.Since(start)
+
+	return []*Summary{inserts, deletes}
+}
+
+func runWrite(ctx context.Context, store db.StatementStore, timeout time.Duration,
+	write func(ctx context.Context, store db.StatementStore) error) (int64, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	counter, ok := store.(rowCounter)
+	if !ok {
+		err := write(ctx, store)
+		return 0, time.Since(start), err
+	}
+
+	rows, err := counter.CountWrites(ctx, func(store db.StatementStore) error { return write(ctx, store) })
+
+	return rows, time.Since(start), err
+}
+
+// addWrite adds a write of the given number of rows and reports whether it succeeded.
+func (s *Summary) addWrite(rows int64, latency time.Duration, err error) bool {
+	s.add(writeScenario, Result{Count: int(rows)}, latency, err)
+
+	if err != nil {
+		return false
+	}
+
+	s.Rows += rows
+
+	return true
+}
+
+// RowsPerWrite returns the mean number of table rows written by a successful write of RunWrites, or 0 if the store
+// counts no rows.
+func (s *Summary) RowsPerWrite() float64 {
+	if s.Succeeded == 0 {
+		return 0
+	}
+
+	return float64(s.Rows) / float64(s.Succeeded)
+}
@@ -0,0 +1,746 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"iam-performance-test/benchmark"
+	"iam-performance-test/config"
+	"iam-performance-test/db"
+	"iam-performance-test/model"
+	"os"
+	"strings"
+	"time"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{name: "migrate", description: "create the statement tables and indexes of the configured schemas", run: runMigrate},
+	{name: "seed", description: "fill the store with generated statements", run: runSeed},
+	{name: "run", description: "run benchmark scenarios", run: runBenchmark},
+	{name: "export", description: "write all statements to a compressed snapshot file", run: runExport},
+	{name: "import", description: "fill an empty store with the statements of a snapshot file", run: runImport},
+	{name: "report", description: "render a run report, or report the size of the seeded dataset", run: runReport},
+	{name: "compare", description: "compare two run reports and fail on regressions", run: runCompare},
+	{name: "reset", description: "remove all statements", run: runReset},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+const (
+	casesMode      = "cases"
+	loadMode       = "load"
+	connectionMode = "connection"
+	indexMode      = "index"
+	writesMode     = "writes"
+)
+
+// options are the flags shared by all commands.
+type options struct {
+	fs           *flag.FlagSet
+	configPath   string
+	backend      string
+	schemas      string
+	dataset      config.Dataset // Non-zero values override the config
+	queryTimeout time.Duration
+}
+
+func newOptions(fs *flag.FlagSet) *options {
+	o := &options{fs: fs}
+
+	fs.StringVar(&o.configPath, "config", "", "optional YAML or JSON config file; IAM_PERF_* environment variables and .env take precedence")
+	fs.StringVar(&o.backend, "backend", "", "statement store backend overriding the config: postgres, sqlite or memory")
+	fs.StringVar(&o.schemas, "schemas", "", "comma-separated postgres statement schemas overriding the config: array, jsonb, normalized, ltree or effective; "+
+		"the first one serves load, connection and index modes and export")
+	fs.IntVar(&o.dataset.ServiceCount, "services", 0, "number of generated services overriding the config")
+	fs.IntVar(&o.dataset.StatementCount, "statements", 0, "number of generated statements per service overriding the config")
+	fs.IntVar(&o.dataset.ResourceCount, "resources", 0, "number of resources per generated statement overriding the config")
+	fs.IntVar(&o.dataset.PrincipalCount, "principals", 0, "number of principals per generated statement overriding the config")
+	fs.IntVar(&o.dataset.BatchSize, "batch-size", 0, "number of statements created or loaded at once overriding the config")
+	fs.Int64Var(&o.dataset.Seed, "data-seed", 0, "seed of the generated statements overriding the config")
+	fs.DurationVar(&o.queryTimeout, "query-timeout", 30*time.Second, "timeout of a single search query")
+
+	return o
+}
+
+// loadConfig loads the config and applies the flag overrides.
+func (o *options) loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(o.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.backend != "" {
+		cfg.Database.Backend = o.backend
+	}
+
+	if o.schemas != "" {
+		cfg.Database.Schemas = config.SplitList(o.schemas)
+	}
+
+	for _, override := range []struct{ value, target *int }{
+		{&o.dataset.ServiceCount, &cfg.Dataset.ServiceCount},
+		{&o.dataset.StatementCount, &cfg.Dataset.StatementCount},
+		{&o.dataset.ResourceCount, &cfg.Dataset.ResourceCount},
+		{&o.dataset.PrincipalCount, &cfg.Dataset.PrincipalCount},
+		{&o.dataset.BatchSize, &cfg.Dataset.BatchSize},
+	} {
+		if *override.value != 0 {
+			*override.target = *override.value
+		}
+	}
+
+	o.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "data-seed" {
+			cfg.Dataset.Seed = o.dataset.Seed
+		}
+	})
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// open loads the config and opens its statement store. The caller must close the store.
+func (o *options) open() (*IAM, *config.Config, error) {
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := &IAM{queryTimeout: o.queryTimeout}
+
+	if err = s.openStatementStore(cfg.Database); err != nil {
+		return nil, nil, fmt.Errorf("opening %s statement store: %w", cfg.Database.Backend, err)
+	}
+
+	return s, cfg, nil
+}
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	o := newOptions(fs)
+	_ = fs.Parse(args)
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	if s.databaseClient == nil {
+		fmt.Printf("The %s backend is migrated when opened\n", cfg.Database.Backend)
+		return nil
+	}
+
+	for _, store := range s.schemaStores {
+		if err = store.Schema().Migrate(ctx); err != nil {
+			return fmt.Errorf("migrating the %s schema: %w", store.Schema().Name(), err)
+		}
+
+		fmt.Printf("Schema %s migrated\n", store.Schema().Name())
+	}
+
+	return nil
+}
+
+func runSeed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	o := newOptions(fs)
+	manifest := fs.String("manifest", defaultManifest, "file receiving the manifest of planted probes, empty to skip")
+	bulk := fs.Bool("copy", true, "load postgres statements with COPY, dropping the indexes during the load and recreating them afterwards")
+	_ = fs.Parse(args)
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	if cfg.Database.Backend == config.BackendMemory {
+		fmt.Println("The memory backend keeps no statements after exit; use run -seed instead")
+		return nil
+	}
+
+	return s.fill(ctx, cfg.Dataset, *manifest, *bulk)
+}
+
+// defaultManifest is the default probe manifest file.
+const defaultManifest = "probes.json"
+
+// fill generates the dataset into the store of every schema, with COPY if bulk and the schema store supports it, and
+// writes the manifest of its probes unless the path is empty.
+func (s *IAM) fill(ctx context.Context, dataset config.Dataset, manifest string, bulk bool) error {
+	for _, named := range s.stores() {
+		if named.schema != "" {
+			fmt.Printf("Seeding the %s schema\n", named.schema)
+		}
+
+		if pg, ok := named.store.(*db.PostgresStore); ok && bulk && pg.CanCopy() {
+			if err := bulkLoad(ctx, pg, dataset); err != nil {
+				return err
+			}
+		} else if err := db.FillStatement(ctx, named.store, dataset); err != nil {
+			return err
+		}
+	}
+
+	if manifest == "" {
+		return nil
+	}
+
+	if err := db.WriteProbeManifest(manifest, &db.ProbeManifest{Dataset: dataset, Probes: db.Probes()}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Probe manifest written to %s\n", manifest)
+
+	return nil
+}
+
+func bulkLoad(ctx context.Context, store *db.PostgresStore, dataset config.Dataset) error {
+	fmt.Println("Dropping the statement indexes and copying statements")
+
+	stats, err := store.BulkLoad(ctx, dataset, printLoadProgress)
+	if err != nil {
+		return err
+	}
+
+	printLoadStats(stats)
+
+	return nil
+}
+
+func printLoadProgress(p db.LoadProgress) {
+	fmt.Printf("%d of %d statements copied in %s; %.0f rows/s\n", p.Rows, p.Total, p.Elapsed.Round(time.Second), p.RowsPerSecond())
+}
+
+func printLoadStats(stats *db.LoadStats) {
+	fmt.Printf("%d statements copied in %s; %.0f rows/s; indexes recreated in %s\n",
+		stats.Rows, stats.Copy.Round(time.Millisecond), stats.RowsPerSecond(), stats.Indexes.Round(time.Millisecond))
+}
+
+func runBenchmark(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	o := newOptions(fs)
+	scenarioFile := fs.String("scenario-file", "", "YAML or JSON scenario file, the built-in scenarios by default")
+	names := fs.String("scenarios", "", "comma-separated scenarios to run in cases mode, all by default")
+	list := fs.Bool("list", false, "list the scenarios and exit")
+	seed := fs.Bool("seed", false, "fill the store with generated statements before running, e.g. for the memory backend")
+	snapshot := fs.String("snapshot", "", "snapshot file written by export to fill the store with before running, e.g. for the memory backend")
+	manifest := fs.String("manifest", defaultManifest, "file receiving the manifest of probes planted by -seed or -snapshot, empty to skip")
+	probes := fs.String("probes", "", "probe manifest written by seed; adds a scenario asserting the decision of each probe")
+	mode := fs.String("mode", casesMode, "benchmark mode: cases; load to mix the scenarios by weight under concurrent load; "+
+		"connection to compare cold and warm connection latency (postgres only); index to compare the in-process KRN index with the store; "+
+		"writes to measure inserting and deleting generated statements one by one along with the table rows postgres counts per write")
+	iterations := fs.Int("iterations", 0, "number of measured queries overriding the scenarios; "+
+		"per connection or evaluation kind in connection and index modes and statements written in writes mode, 10 by default")
+	warmup := fs.Int("warmup", -1, "number of unmeasured queries before the measured ones overriding the scenarios")
+	concurrency := fs.Int("concurrency", 0, "number of concurrent queries overriding the scenarios")
+	workers := fs.Int("workers", 10, "number of load workers, i.e. the maximum number of queries in flight in load mode")
+	openLoop := fs.Bool("open-loop", false, "issue load queries at the stage target rate instead of back to back")
+	stages := fs.String("stages", "10s:10,50s:10", "comma-separated load stages as duration:target, ramping linearly from the previous target; "+
+		"targets are active workers, or queries per second with -open-loop")
+	window := fs.Duration("window", 10*time.Second, "interval of load throughput and latency reports")
+	explain := fs.Bool("explain", false, "capture the EXPLAIN (ANALYZE, BUFFERS) plan of every scenario query after running it in cases mode "+
+		"(postgres only)")
+	reportPath := fs.String("report", "reports", "report file (.json, .csv or .md) or directory receiving a JSON report of cases, load and writes modes; "+
+		"empty to skip")
+	_ = fs.Parse(args)
+
+	scenarios, err := loadScenarios(*scenarioFile, *names)
+	if err != nil {
+		return err
+	}
+
+	if *probes != "" {
+		m, err := db.ReadProbeManifest(*probes)
+		if err != nil {
+			return err
+		}
+
+		scenarios = append(scenarios, benchmark.ProbeScenarios(m.Probes)...)
+	}
+
+	if *list {
+		for i := range scenarios {
+			fmt.Printf("%-10s %-16s %s\n", scenarios[i].Name, scenarios[i].Kind, scenarios[i].Description)
+		}
+
+		return nil
+	}
+
+	for i := range scenarios {
+		if *warmup >= 0 {
+			scenarios[i].Warmup = *warmup
+		}
+
+		if *iterations > 0 {
+			scenarios[i].Iterations = *iterations
+		}
+
+		if *concurrency > 0 {
+			scenarios[i].Concurrency = *concurrency
+		}
+	}
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	switch {
+	case *seed && *snapshot != "":
+		return errors.New("-seed and -snapshot are mutually exclusive")
+	case *seed:
+		if err = s.fill(ctx, cfg.Dataset, *manifest, true); err != nil {
+			return err
+		}
+	case *snapshot != "":
+		header, err := s.importSnapshot(ctx, *snapshot, cfg.Dataset.BatchSize, *manifest, true)
+		if err != nil {
+			return err
+		}
+
+		// Report the dataset of the snapshot rather than the configured one
+		cfg.Dataset = header.Dataset
+	}
+
+	if *iterations == 0 {
+		*iterations = 10
+	}
+
+	metadata := benchmark.NewMetadata(*mode, cfg.Database.Backend, cfg.Dataset)
+	stores := s.stores()
+
+	switch *mode {
+	case casesMode:
+		if *explain && s.databaseClient == nil {
+			return errors.New("-explain requires the postgres backend")
+		}
+
+		var summaries []*benchmark.Summary
+
+		for _, named := range stores {
+			if len(stores) > 1 {
+				fmt.Println("=====================================================================================================")
+				fmt.Printf("SCHEMA %s\n", strings.ToUpper(named.schema))
+				metadata.Schemas = append(metadata.Schemas, named.schema)
+			}
+
+			for _, summary := range s.runScenarios(ctx, named.store, scenarios, *explain) {
+				if len(stores) > 1 {
+					summary.Schema = named.schema
+				}
+
+				summaries = append(summaries, summary)
+			}
+		}
+
+		return s.writeReport(ctx, *reportPath, benchmark.NewReport(metadata, summaries))
+	case loadMode:
+		if len(stores) > 1 {
+			fmt.Printf("Load mode runs against the %s schema only\n", stores[0].schema)
+		}
+
+		loadStages, err := benchmark.ParseStages(*stages)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.runLoad(ctx, &benchmark.Load{
+			Scenarios:    scenarios,
+			Workers:      *workers,
+			OpenLoop:     *openLoop,
+			Stages:       loadStages,
+			Window:       *window,
+			QueryTimeout: s.queryTimeout,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.writeReport(ctx, *reportPath, benchmark.NewLoadReport(metadata, res))
+	case writesMode:
+		var summaries []*benchmark.Summary
+
+		for _, named := range stores {
+			if len(stores) > 1 {
+				fmt.Println("=====================================================================================================")
+				fmt.Printf("SCHEMA %s\n", strings.ToUpper(named.schema))
+				metadata.Schemas = append(metadata.Schemas, named.schema)
+			}
+
+			for _, summary := range s.runWrites(ctx, named.store, cfg.Dataset, *iterations) {
+				if len(stores) > 1 {
+					summary.Schema = named.schema
+				}
+
+				summaries = append(summaries, summary)
+			}
+		}
+
+		return s.writeReport(ctx, *reportPath, benchmark.NewReport(metadata, summaries))
+	case connectionMode:
+		if s.databaseClient == nil {
+			return errors.New("connection mode requires the postgres backend")
+		}
+
+		s.runConnectionLatency(ctx, cfg.Database, *iterations)
+	case indexMode:
+		s.runIndexComparison(ctx, cfg.Dataset, *iterations)
+	default:
+		return fmt.Errorf("unknown mode %q", *mode)
+	}
+
+	return nil
+}
+
+// loadScenarios loads the scenario file, or the built-in scenarios for an empty path, and selects the scenarios with
+// the given comma-separated names.
+func loadScenarios(path, names string) ([]benchmark.Scenario, error) {
+	var scenarios []benchmark.Scenario
+	var err error
+
+	if path == "" {
+		scenarios, err = benchmark.DefaultScenarios()
+	} else {
+		scenarios, err = benchmark.LoadScenarios(path)
+	}
+
+	if err != nil || names == "" {
+		return scenarios, err
+	}
+
+	selected := strings.Split(names, ",")
+	for i := range selected {
+		selected[i] = strings.TrimSpace(selected[i])
+	}
+
+	return benchmark.Select(scenarios, selected...)
+}
+
+func runReport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	o := newOptions(fs)
+	in := fs.String("in", "", "JSON run report to render instead of reporting the dataset")
+	format := fs.String("format", benchmark.FormatMarkdown, "rendered report format: json, csv or markdown")
+	_ = fs.Parse(args)
+
+	if *in != "" {
+		report, err := benchmark.ReadReport(*in)
+		if err != nil {
+			return err
+		}
+
+		return report.Write(os.Stdout, *format)
+	}
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	fmt.Printf("Backend: %s\n", cfg.Database.Backend)
+
+	for _, named := range s.stores() {
+		counts, err := named.store.CountByType(ctx)
+		if err != nil {
+			return err
+		}
+
+		var total int64
+		for _, count := range counts {
+			total += count
+		}
+
+		pg, ok := named.store.(*db.PostgresStore)
+		if !ok {
+			fmt.Printf("Statements: %d (%s %d, %s %d)\n", total, model.Allow, counts[model.Allow], model.Deny, counts[model.Deny])
+			continue
+		}
+
+		size, err := pg.Size(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Schema %s: %d statements (%s %d, %s %d); tables: %s; indexes: %s; total: %s\n", named.schema, total,
+			model.Allow, counts[model.Allow], model.Deny, counts[model.Deny], formatBytes(size.Table), formatBytes(size.Indexes), formatBytes(size.Total))
+	}
+
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	o := newOptions(fs)
+	out := fs.String("out", defaultSnapshot, "snapshot file receiving gzip-compressed newline-delimited JSON statements")
+	manifest := fs.String("manifest", defaultManifest, "probe manifest written by seed, whose dataset goes into the snapshot header; "+
+		"the configured dataset if missing")
+	_ = fs.Parse(args)
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	if cfg.Database.Backend == config.BackendMemory {
+		return errors.New("the memory backend keeps no statements to export")
+	}
+
+	dataset := cfg.Dataset
+
+	if m, err := db.ReadProbeManifest(*manifest); err == nil {
+		dataset = m.Dataset
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else {
+		fmt.Printf("No probe manifest %s, the snapshot header holds the configured dataset\n", *manifest)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			os.Remove(*out)
+		}
+	}()
+
+	header, err := db.Export(ctx, s.store, f, dataset)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d statements exported to %s\n", header.Statements, *out)
+
+	return nil
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	o := newOptions(fs)
+	in := fs.String("in", defaultSnapshot, "snapshot file written by export")
+	manifest := fs.String("manifest", defaultManifest, "file receiving the manifest of the probes planted in the snapshot dataset, empty to skip")
+	bulk := fs.Bool("copy", true, "load postgres statements with COPY, dropping the indexes during the load and recreating them afterwards")
+	_ = fs.Parse(args)
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	if cfg.Database.Backend == config.BackendMemory {
+		fmt.Println("The memory backend keeps no statements after exit; use run -snapshot instead")
+		return nil
+	}
+
+	_, err = s.importSnapshot(ctx, *in, cfg.Dataset.BatchSize, *manifest, *bulk)
+
+	return err
+}
+
+// defaultSnapshot is the default statement snapshot file.
+const defaultSnapshot = "statements.ndjson.gz"
+
+// importSnapshot fills the empty store of every schema with the statements of the snapshot file, with COPY if bulk and
+// the schema store supports it, writes the probe manifest of its dataset unless the path is empty, and returns the
+// snapshot header.
+func (s *IAM) importSnapshot(ctx context.Context, path string, batchSize int, manifest string, bulk bool) (*db.SnapshotHeader, error) {
+	stores := s.stores()
+
+	for _, named := range stores {
+		counts, err := named.store.CountByType(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, count := range counts {
+			if count > 0 {
+				return nil, errors.New("the store is not empty, remove its statements with reset -yes before importing")
+			}
+		}
+	}
+
+	var header *db.SnapshotHeader
+
+	for _, named := range stores {
+		if named.schema != "" {
+			fmt.Printf("Importing into the %s schema\n", named.schema)
+		}
+
+		var err error
+		if header, err = importStore(ctx, named.store, path, batchSize, bulk); err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest != "" {
+		if err := db.WriteProbeManifest(manifest, &db.ProbeManifest{Dataset: header.Dataset, Probes: db.Probes()}); err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Probe manifest written to %s\n", manifest)
+	}
+
+	return header, nil
+}
+
+// importStore fills the store with the statements of the snapshot file like importSnapshot.
+func importStore(ctx context.Context, store db.StatementStore, path string, batchSize int, bulk bool) (*db.SnapshotHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r, err := db.NewSnapshotReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	defer r.Close()
+
+	fmt.Printf("Importing %d statements exported at %s with seed %d\n", r.Header.Statements, r.Header.CreatedAt.Format(time.RFC3339), r.Header.Dataset.Seed)
+
+	if pg, ok := store.(*db.PostgresStore); ok && bulk && pg.CanCopy() {
+		fmt.Println("Dropping the statement indexes and copying statements")
+
+		stats, err := pg.BulkImport(ctx, r, printLoadProgress)
+		if err != nil {
+			return nil, fmt.Errorf("importing %s: %w", path, err)
+		}
+
+		printLoadStats(stats)
+	} else {
+		created, err := db.Import(ctx, store, r, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("importing %s: %w", path, err)
+		}
+
+		fmt.Printf("%d statements imported\n", created)
+	}
+
+	return &r.Header, nil
+}
+
+func runCompare(_ context.Context, args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	percentile := fs.String("percentile", benchmark.PercentileP50, "compared latency percentile: p50, p90, p99 or p999")
+	threshold := fs.Float64("threshold", 10, "relative percentile increase in percent beyond which a significant change is a regression")
+	alpha := fs.Float64("alpha", 0.05, "significance level of the Mann-Whitney U test over the latency samples")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] <base report> <head report>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("compare takes a base and a head JSON report")
+	}
+
+	base, err := benchmark.ReadReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	head, err := benchmark.ReadReport(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	comparison, err := benchmark.Compare(base, head, *percentile, *threshold, *alpha)
+	if err != nil {
+		return err
+	}
+
+	if err = comparison.WriteMarkdown(os.Stdout); err != nil {
+		return err
+	}
+
+	if regressions := comparison.Regressions(); len(regressions) > 0 {
+		return fmt.Errorf("%d scenarios regressed: %s", len(regressions), strings.Join(regressions, ", "))
+	}
+
+	return nil
+}
+
+func runReset(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ExitOnError)
+	o := newOptions(fs)
+	confirmed := fs.Bool("yes", false, "confirm removing all statements")
+	_ = fs.Parse(args)
+
+	if !*confirmed {
+		return errors.New("reset removes all statements, confirm with -yes")
+	}
+
+	s, cfg, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	defer s.store.Close()
+
+	for _, named := range s.stores() {
+		if err = named.store.Reset(ctx); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("All statements removed from the %s backend\n", cfg.Database.Backend)
+
+	return nil
+}
+
+// formatBytes returns the human-readable size in binary units, e.g. "1.5 MiB".
+func formatBytes(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
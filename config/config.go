@@ -0,0 +1,489 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Supported log levels. They map onto the gorm logger levels.
+const (
+	LogLevelSilent = "silent"
+	LogLevelError  = "error"
+	LogLevelWarn   = "warn"
+	LogLevelInfo   = "info"
+)
+
+// Supported statement store backends.
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Supported PostgreSQL statement schemas, i.e. storage layouts.
+const (
+	// SchemaArray keeps statement values in text[] columns with GIN indexes.
+	SchemaArray = "array"
+	// SchemaJSONB keeps statement values in a jsonb document with a jsonb_path_ops GIN index.
+	SchemaJSONB = "jsonb"
+	// SchemaNormalized keeps statement values in child tables with B-tree indexes.
+	SchemaNormalized = "normalized"
+	// SchemaLtree keeps statement KRNs in ltree[] columns with GiST indexes.
+	SchemaLtree = "ltree"
+	// SchemaEffective keeps statements as SchemaArray does along with their trigger maintained effective permissions.
+	SchemaEffective = "effective"
+)
+
+// Distributions of generated dataset values.
+const (
+	// DistributionConstant always yields the maximum count, or spreads statements evenly over tenants.
+	DistributionConstant Distribution = "constant"
+	// DistributionUniform yields every value with the same probability.
+	DistributionUniform Distribution = "uniform"
+	// DistributionZipf yields small counts and the first tenants or IDs most often, skewed by Dataset.ZipfSkew.
+	DistributionZipf Distribution = "zipf"
+)
+
+// Limits of the generated action variety.
+const (
+	MaxActionCount       = 6
+	MaxResourceTypeCount = 10
+)
+
+// Environment variables overriding the configuration file values.
+const (
+	envPrefix          = "IAM_PERF_"
+	envBackend         = envPrefix + "BACKEND"
+	envDSN             = envPrefix + "DSN"
+	envSQLitePath      = envPrefix + "SQLITE_PATH"
+	envLogLevel        = envPrefix + "LOG_LEVEL"
+	envSchemas         = envPrefix + "SCHEMAS"
+	envMaxOpenConns    = envPrefix + "MAX_OPEN_CONNS"
+	envMaxIdleConns    = envPrefix + "MAX_IDLE_CONNS"
+	envConnMaxLifetime = envPrefix + "CONN_MAX_LIFETIME"
+	envConnMaxIdleTime = envPrefix + "CONN_MAX_IDLE_TIME"
+	envServiceCount    = envPrefix + "SERVICE_COUNT"
+	envStatementCount  = envPrefix + "STATEMENT_COUNT"
+	envResourceCount   = envPrefix + "RESOURCE_COUNT"
+	envPrincipalCount  = envPrefix + "PRINCIPAL_COUNT"
+	envBatchSize       = envPrefix + "BATCH_SIZE"
+	envSeed            = envPrefix + "SEED"
+)
+
+// DotEnvFile is loaded into the process environment by Load when present. Variables already set are not overridden.
+const DotEnvFile = ".env"
+
+// Config is the complete benchmark configuration.
+type Config struct {
+	Database Database `json:"database" yaml:"database"`
+	Dataset  Dataset  `json:"dataset"  yaml:"dataset"`
+}
+
+// Database configures the statement store connection.
+type Database struct {
+	Backend    string `json:"backend"    yaml:"backend"`
+	DSN        string `json:"dsn"        yaml:"dsn"`
+	SQLitePath string `json:"sqlitePath" yaml:"sqlitePath"`
+	LogLevel   string `json:"logLevel"   yaml:"logLevel"`
+	Pool       Pool   `json:"pool"       yaml:"pool"`
+	// Schemas are the PostgreSQL statement schemas seeded and benchmarked side by side. Every schema keeps its own
+	// tables, and the first one serves the commands working on a single store.
+	Schemas []string `json:"schemas" yaml:"schemas"`
+}
+
+// Pool holds the database/sql connection pool settings. Zero values keep the database/sql defaults.
+type Pool struct {
+	MaxOpenConns    int      `json:"maxOpenConns"    yaml:"maxOpenConns"`
+	MaxIdleConns    int      `json:"maxIdleConns"    yaml:"maxIdleConns"`
+	ConnMaxLifetime Duration `json:"connMaxLifetime" yaml:"connMaxLifetime"`
+	ConnMaxIdleTime Duration `json:"connMaxIdleTime" yaml:"connMaxIdleTime"`
+}
+
+// Dataset configures the size and shape of generated statements.
+//
+// ServiceCount*StatementCount statements are generated in total, each having up to ResourceCount resources,
+// PrincipalCount principals and ActionCount actions, as drawn from the respective distributions. BatchSize is the
+// number of statements stored at once. Datasets generated with equal settings, including the Seed, are identical.
+type Dataset struct {
+	ServiceCount   int   `json:"serviceCount"   yaml:"serviceCount"`
+	StatementCount int   `json:"statementCount" yaml:"statementCount"`
+	ResourceCount  int   `json:"resourceCount"  yaml:"resourceCount"`
+	PrincipalCount int   `json:"principalCount" yaml:"principalCount"`
+	BatchSize      int   `json:"batchSize"      yaml:"batchSize"`
+	Seed           int64 `json:"seed"           yaml:"seed"`
+
+	// TenantCount is the number of tenants of a service, or 0 for a tenant per statement.
+	TenantCount        int          `json:"tenantCount"        yaml:"tenantCount"`
+	TenantDistribution Distribution `json:"tenantDistribution" yaml:"tenantDistribution"`
+
+	ResourceDistribution  Distribution `json:"resourceDistribution"  yaml:"resourceDistribution"`
+	PrincipalDistribution Distribution `json:"principalDistribution" yaml:"principalDistribution"`
+
+	// ActionCount is the maximum number of operations granted by a statement on its resource type, of which there are
+	// ResourceTypeCount per service.
+	ActionCount        int          `json:"actionCount"        yaml:"actionCount"`
+	ActionDistribution Distribution `json:"actionDistribution" yaml:"actionDistribution"`
+	ResourceTypeCount  int          `json:"resourceTypeCount"  yaml:"resourceTypeCount"`
+
+	// PoolCount is the number of pools of a tenant besides the root pool, and PathDepth the maximum number of resource
+	// path sub-tokens.
+	PoolCount int `json:"poolCount" yaml:"poolCount"`
+	PathDepth int `json:"pathDepth" yaml:"pathDepth"`
+
+	// IDCount is the number of resource and principal IDs of a tenant drawn from by IDDistribution, or 0 for a unique
+	// ID per KRN.
+	IDCount        int          `json:"idCount"        yaml:"idCount"`
+	IDDistribution Distribution `json:"idDistribution" yaml:"idDistribution"`
+
+	// ZipfSkew is the exponent of zipf distributions and must exceed 1.
+	ZipfSkew float64 `json:"zipfSkew" yaml:"zipfSkew"`
+
+	// DenyRatio is the share of Deny statements.
+	DenyRatio float64   `json:"denyRatio" yaml:"denyRatio"`
+	Wildcards Wildcards `json:"wildcards" yaml:"wildcards"`
+}
+
+// Distribution is the name of a distribution of generated dataset values.
+type Distribution string
+
+// Wildcards are the shares of statements having a wildcard resource and a wildcard principal at each KRN level, e.g.
+// krn:svc:* for Service, krn:svc:tenant:* for Tenant, krn:svc:tenant:/* for Pool, krn:svc:tenant::* for
+// ResourceType and krn:svc:tenant::endpoint/* for ResourceID. Pool wildcards require a PoolCount.
+type Wildcards struct {
+	Service      float64 `json:"service"      yaml:"service"`
+	Tenant       float64 `json:"tenant"       yaml:"tenant"`
+	Pool         float64 `json:"pool"         yaml:"pool"`
+	ResourceType float64 `json:"resourceType" yaml:"resourceType"`
+	ResourceID   float64 `json:"resourceId"   yaml:"resourceId"`
+}
+
+// Duration is a time.Duration read from strings like "1h30m".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *Duration) UnmarshalText(text []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(text))
+
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// Default returns the configuration used unless overridden.
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			Backend:    BackendPostgres,
+			DSN:        "host=localhost user=iam-perf password=root dbname=iam-perf port=5432 sslmode=disable TimeZone=Europe/Kiev",
+			SQLitePath: "iam-perf.db",
+			LogLevel:   LogLevelInfo,
+			Schemas:    []string{SchemaArray},
+			Pool: Pool{
+				MaxOpenConns:    10,
+				MaxIdleConns:    10,
+				ConnMaxLifetime: Duration{time.Hour},
+				ConnMaxIdleTime: Duration{10 * time.Minute},
+			},
+		},
+		Dataset: Dataset{
+			ServiceCount:   100,
+			StatementCount: 10_000,
+			ResourceCount:  10,
+			PrincipalCount: 5,
+			BatchSize:      500,
+			Seed:           1,
+
+			TenantDistribution:    DistributionConstant,
+			ResourceDistribution:  DistributionConstant,
+			PrincipalDistribution: DistributionConstant,
+			ActionCount:           3,
+			ActionDistribution:    DistributionConstant,
+			ResourceTypeCount:     1,
+			IDDistribution:        DistributionUniform,
+			ZipfSkew:              1.2,
+			Wildcards:             Wildcards{Service: 0.1, ResourceType: 1},
+		},
+	}
+}
+
+// Load builds the configuration from defaults, then the optional YAML or JSON file at path, then environment variables
+// (including those from a DotEnvFile in the working directory), and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := godotenv.Load(DotEnvFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading %s: %w", DotEnvFile, err)
+	}
+
+	if err := cfg.readEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate returns an ErrInvalidConfig-wrapping error describing the first invalid setting.
+func (c *Config) Validate() error {
+	switch c.Database.Backend {
+	case BackendPostgres:
+		if c.Database.DSN == "" {
+			return fmt.Errorf("%w: DSN is required for the %s backend", ErrInvalidConfig, BackendPostgres)
+		}
+	case BackendSQLite:
+		if c.Database.SQLitePath == "" {
+			return fmt.Errorf("%w: SQLite path is required for the %s backend", ErrInvalidConfig, BackendSQLite)
+		}
+	case BackendMemory:
+	default:
+		return fmt.Errorf("%w: unknown backend %q", ErrInvalidConfig, c.Database.Backend)
+	}
+
+	if len(c.Database.Schemas) == 0 {
+		return fmt.Errorf("%w: at least one schema is required", ErrInvalidConfig)
+	}
+
+	schemas := make(map[string]bool, len(c.Database.Schemas))
+
+	for _, schema := range c.Database.Schemas {
+		switch {
+		case !isSchema(schema):
+			return fmt.Errorf("%w: unknown schema %q", ErrInvalidConfig, schema)
+		case schemas[schema]:
+			return fmt.Errorf("%w: duplicate schema %q", ErrInvalidConfig, schema)
+		case schema != SchemaArray && c.Database.Backend != BackendPostgres:
+			return fmt.Errorf("%w: the %s schema requires the %s backend", ErrInvalidConfig, schema, BackendPostgres)
+		}
+
+		schemas[schema] = true
+	}
+
+	switch c.Database.LogLevel {
+	case LogLevelSilent, LogLevelError, LogLevelWarn, LogLevelInfo:
+	default:
+		return fmt.Errorf("%w: unknown log level %q", ErrInvalidConfig, c.Database.LogLevel)
+	}
+
+	pool := c.Database.Pool
+
+	switch {
+	case pool.MaxOpenConns < 0:
+		return fmt.Errorf("%w: max open connections must not be negative", ErrInvalidConfig)
+	case pool.MaxIdleConns < 0:
+		return fmt.Errorf("%w: max idle connections must not be negative", ErrInvalidConfig)
+	case pool.MaxOpenConns > 0 && pool.MaxIdleConns > pool.MaxOpenConns:
+		return fmt.Errorf("%w: max idle connections exceed max open connections", ErrInvalidConfig)
+	case pool.ConnMaxLifetime.Duration < 0:
+		return fmt.Errorf("%w: connection max lifetime must not be negative", ErrInvalidConfig)
+	case pool.ConnMaxIdleTime.Duration < 0:
+		return fmt.Errorf("%w: connection max idle time must not be negative", ErrInvalidConfig)
+	}
+
+	dataset := c.Dataset
+
+	switch {
+	case dataset.ServiceCount < 1:
+		return fmt.Errorf("%w: service count must be positive", ErrInvalidConfig)
+	case dataset.StatementCount < 1:
+		return fmt.Errorf("%w: statement count must be positive", ErrInvalidConfig)
+	case dataset.ResourceCount < 1:
+		return fmt.Errorf("%w: resource count must be positive", ErrInvalidConfig)
+	case dataset.PrincipalCount < 1:
+		return fmt.Errorf("%w: principal count must be positive", ErrInvalidConfig)
+	case dataset.BatchSize < 1:
+		return fmt.Errorf("%w: batch size must be positive", ErrInvalidConfig)
+	case dataset.TenantCount < 0:
+		return fmt.Errorf("%w: tenant count must not be negative", ErrInvalidConfig)
+	case dataset.ActionCount < 1 || dataset.ActionCount > MaxActionCount:
+		return fmt.Errorf("%w: action count must be between 1 and %d", ErrInvalidConfig, MaxActionCount)
+	case dataset.ResourceTypeCount < 1 || dataset.ResourceTypeCount > MaxResourceTypeCount:
+		return fmt.Errorf("%w: resource type count must be between 1 and %d", ErrInvalidConfig, MaxResourceTypeCount)
+	case dataset.PoolCount < 0:
+		return fmt.Errorf("%w: pool count must not be negative", ErrInvalidConfig)
+	case dataset.PathDepth < 0:
+		return fmt.Errorf("%w: path depth must not be negative", ErrInvalidConfig)
+	case dataset.IDCount < 0:
+		return fmt.Errorf("%w: ID count must not be negative", ErrInvalidConfig)
+	case dataset.Wildcards.Pool > 0 && dataset.PoolCount == 0:
+		return fmt.Errorf("%w: pool wildcards require a pool count", ErrInvalidConfig)
+	}
+
+	for _, d := range []struct {
+		name         string
+		distribution Distribution
+	}{
+		{"tenant", dataset.TenantDistribution},
+		{"resource", dataset.ResourceDistribution},
+		{"principal", dataset.PrincipalDistribution},
+		{"action", dataset.ActionDistribution},
+		{"ID", dataset.IDDistribution},
+	} {
+		switch d.distribution {
+		case DistributionConstant, DistributionUniform:
+		case DistributionZipf:
+			if dataset.ZipfSkew <= 1 {
+				return fmt.Errorf("%w: zipf skew must exceed 1", ErrInvalidConfig)
+			}
+		default:
+			return fmt.Errorf("%w: unknown %s distribution %q", ErrInvalidConfig, d.name, d.distribution)
+		}
+	}
+
+	for _, r := range []struct {
+		name  string
+		ratio float64
+	}{
+		{"deny", dataset.DenyRatio},
+		{"service wildcard", dataset.Wildcards.Service},
+		{"tenant wildcard", dataset.Wildcards.Tenant},
+		{"pool wildcard", dataset.Wildcards.Pool},
+		{"resource type wildcard", dataset.Wildcards.ResourceType},
+		{"resource ID wildcard", dataset.Wildcards.ResourceID},
+	} {
+		if r.ratio < 0 || r.ratio > 1 {
+			return fmt.Errorf("%w: %s ratio must be between 0 and 1", ErrInvalidConfig, r.name)
+		}
+	}
+
+	return nil
+}
+
+func isSchema(name string) bool {
+	switch name {
+	case SchemaArray, SchemaJSONB, SchemaNormalized, SchemaLtree, SchemaEffective:
+		return true
+	}
+
+	return false
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".json":
+		err = json.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("%w: unsupported config file extension %q", ErrInvalidConfig, ext)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: parsing %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) readEnv() error {
+	for _, v := range []struct {
+		name   string
+		target *string
+	}{
+		{envBackend, &c.Database.Backend},
+		{envDSN, &c.Database.DSN},
+		{envSQLitePath, &c.Database.SQLitePath},
+		{envLogLevel, &c.Database.LogLevel},
+	} {
+		if value, ok := os.LookupEnv(v.name); ok {
+			*v.target = value
+		}
+	}
+
+	if value, ok := os.LookupEnv(envSchemas); ok {
+		c.Database.Schemas = SplitList(value)
+	}
+
+	for _, v := range []struct {
+		name   string
+		target *int
+	}{
+		{envMaxOpenConns, &c.Database.Pool.MaxOpenConns},
+		{envMaxIdleConns, &c.Database.Pool.MaxIdleConns},
+		{envServiceCount, &c.Dataset.ServiceCount},
+		{envStatementCount, &c.Dataset.StatementCount},
+		{envResourceCount, &c.Dataset.ResourceCount},
+		{envPrincipalCount, &c.Dataset.PrincipalCount},
+		{envBatchSize, &c.Dataset.BatchSize},
+	} {
+		value, ok := os.LookupEnv(v.name)
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.ReplaceAll(value, "_", ""))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, v.name, err)
+		}
+
+		*v.target = n
+	}
+
+	if value, ok := os.LookupEnv(envSeed); ok {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, envSeed, err)
+		}
+
+		c.Dataset.Seed = seed
+	}
+
+	for _, v := range []struct {
+		name   string
+		target *Duration
+	}{
+		{envConnMaxLifetime, &c.Database.Pool.ConnMaxLifetime},
+		{envConnMaxIdleTime, &c.Database.Pool.ConnMaxIdleTime},
+	} {
+		value, ok := os.LookupEnv(v.name)
+		if !ok {
+			continue
+		}
+
+		if err := v.target.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, v.name, err)
+		}
+	}
+
+	return nil
+}
+
+// SplitList splits a comma-separated list, trimming spaces around the items and dropping empty ones.
+func SplitList(s string) []string {
+	var res []string
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
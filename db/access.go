@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+)
+
+// Access lists who may perform an action on a resource.
+type Access struct {
+	// Principals are the effective principal patterns of matching Allow statements.
+	Principals []PrincipalAccess `json:"principals"`
+	// Denied are the principal patterns of matching Deny statements.
+	Denied []string `json:"denied,omitempty"`
+}
+
+// PrincipalAccess is a principal pattern granted access by Allow statements. Patterns completely covered by a Deny
+// statement are never granted, while narrower denied patterns are listed in Except.
+type PrincipalAccess struct {
+	Principal string   `json:"principal"`
+	Except    []string `json:"except,omitempty"`
+}
+
+// WhoHasAccess returns the principal patterns that may perform act on resource, with Deny statements subtracted
+// using the same deny-overrides semantics as Evaluate.
+func WhoHasAccess(ctx context.Context, store StatementStore, act action.Action, resource *krn.KRN) (*Access, error) {
+	switch {
+	case resource == nil:
+		return nil, fmt.Errorf("%w: resource is required", ErrMalformedRequest)
+	case !act.IsValid():
+		return nil, fmt.Errorf("%w: invalid action %q", ErrMalformedRequest, string(act))
+	}
+
+	allowed, err := store.SearchPrincipals(ctx, &EvaluatePermissionRequest{
+		Actions:   act.MatchingActionsString(),
+		Resources: resource.MatchingKRNs(),
+		Type:      model.Allow,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	denied, err := store.SearchPrincipals(ctx, &EvaluatePermissionRequest{
+		Actions:   act.MatchingActionsString(),
+		Resources: resource.MatchingKRNs(),
+		Type:      model.Deny,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	allowedKRNs, err := parseKRNs(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	deniedKRNs, err := parseKRNs(denied)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Access{Principals: make([]PrincipalAccess, 0, len(allowed)), Denied: denied}
+
+allowedLoop:
+	for i, allowedKRN := range allowedKRNs {
+		access := PrincipalAccess{Principal: allowed[i]}
+
+		for j, deniedKRN := range deniedKRNs {
+			switch {
+			case allowedKRN.Matches(deniedKRN):
+				continue allowedLoop
+			case deniedKRN.Matches(allowedKRN):
+				access.Except = append(access.Except, denied[j])
+			}
+		}
+
+		res.Principals = append(res.Principals, access)
+	}
+
+	return res, nil
+}
+
+// IsAllowed returns whether the concrete principal has access.
+func (a *Access) IsAllowed(principal *krn.KRN) bool {
+	matching := newStringSet(principal.MatchingKRNs())
+
+	for _, denied := range a.Denied {
+		if matching.contains(denied) {
+			return false
+		}
+	}
+
+	for i := range a.Principals {
+		if matching.contains(a.Principals[i].Principal) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expand returns the principals of directory that have access, in directory order.
+func (a *Access) Expand(directory []*krn.KRN) []*krn.KRN {
+	res := make([]*krn.KRN, 0)
+
+	for _, principal := range directory {
+		if a.IsAllowed(principal) {
+			res = append(res, principal)
+		}
+	}
+
+	return res
+}
+
+// parseKRNs parses KRNs read from a store.
+func parseKRNs(krns []string) ([]*krn.KRN, error) {
+	res := make([]*krn.KRN, len(krns))
+
+	for i, k := range krns {
+		parsed, err := krn.NewKRNFromString(k)
+		if err != nil {
+			return nil, backendError(err)
+		}
+
+		res[i] = parsed
+	}
+
+	return res, nil
+}
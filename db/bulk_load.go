@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// progressInterval is the minimum interval between bulk load progress reports.
+const progressInterval = 5 * time.Second
+
+// progressCheckRows is the number of copied rows between checks whether a progress report is due.
+const progressCheckRows = 4096
+
+// indexRecreateTimeout bounds recreating the indexes after a bulk load, which outlives the context of the load.
+const indexRecreateTimeout = time.Hour
+
+// LoadProgress is the progress of a bulk load.
+type LoadProgress struct {
+	// Rows is the number of rows copied so far out of Total.
+	Rows, Total int64
+	Elapsed     time.Duration
+}
+
+// LoadStats is the outcome of a bulk load.
+type LoadStats struct {
+	Rows int64
+	// Copy is the time spent copying rows, and Indexes the time spent recreating the indexes afterwards.
+	Copy, Indexes time.Duration
+}
+
+// RowsPerSecond returns the copy throughput so far.
+func (p LoadProgress) RowsPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(p.Rows) / p.Elapsed.Seconds()
+}
+
+// RowsPerSecond returns the copy throughput.
+func (s *LoadStats) RowsPerSecond() float64 {
+	return LoadProgress{Rows: s.Rows, Elapsed: s.Copy}.RowsPerSecond()
+}
+
+// CanCopy reports whether BulkLoad and BulkImport support the schema of the store.
+func (s *PostgresStore) CanCopy() bool {
+	_, ok := s.schema.(copySchema)
+	return ok
+}
+
+// BulkLoad plants the Probes and streams the generated dataset into the statements table of the schema with a single
+// COPY FROM STDIN in the binary format, which encodes text[] values without any quoting. It creates the same
+// statements as FillStatement, only much faster. It fails for schemas spreading statements over several tables, see
+// CanCopy.
+//
+// The statement indexes are dropped before the copy and recreated afterwards, also when the copy fails or ctx is
+// cancelled, as building them once is far cheaper than maintaining them row by row. The copy is atomic: a failed or
+// cancelled load adds no rows. progress, if not nil, is called periodically during the copy.
+func (s *PostgresStore) BulkLoad(ctx context.Context, dataset config.Dataset, progress func(LoadProgress)) (*LoadStats, error) {
+	probes, err := probeStatements(Probes())
+	if err != nil {
+		return nil, err
+	}
+
+	g := NewGenerator(dataset)
+	total := int64(len(probes)) + int64(dataset.ServiceCount)*int64(dataset.StatementCount)
+
+	return s.copyStatements(ctx, newStatementSource(func() (*model.Statement, error) {
+		if len(probes) > 0 {
+			next := probes[0]
+			probes = probes[1:]
+
+			return next, nil
+		}
+
+		return g.Next(), nil
+	}, total, progress))
+}
+
+// copyStatements copies the statements of src like BulkLoad.
+func (s *PostgresStore) copyStatements(ctx context.Context, src *statementSource) (stats *LoadStats, err error) {
+	schema, ok := s.schema.(copySchema)
+	if !ok {
+		return nil, fmt.Errorf("bulk loads do not support the %s schema", s.schema.Name())
+	}
+
+	src.values = schema.copyValues
+
+	sqlDB, err := s.client.Client.DB()
+	if err != nil {
+		return nil, backendError(err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, backendError(err)
+	}
+
+	defer conn.Close()
+
+	if err = s.schema.DropIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	stats = &LoadStats{}
+
+	defer func() {
+		// A cancelled ctx would leave the table without indexes
+		indexCtx, cancel := context.WithTimeout(context.Background(), indexRecreateTimeout)
+		defer cancel()
+
+		start := time.Now()
+		indexErr := s.schema.CreateIndexes(indexCtx)
+		stats.Indexes = time.Since(start)
+
+		switch {
+		case indexErr == nil:
+		case err == nil:
+			err = indexErr
+		default:
+			err = fmt.Errorf("%w; recreating indexes: %v", err, indexErr)
+		}
+	}()
+
+	src.start, src.since = time.Now(), time.Now()
+
+	err = conn.Raw(func(driverConn interface{}) (copyErr error) {
+		stats.Rows, copyErr = driverConn.(*stdlib.Conn).Conn().CopyFrom(ctx, pgx.Identifier{s.table()}, schema.copyColumns(), src)
+
+		return copyErr
+	})
+
+	stats.Copy = time.Since(src.start)
+
+	if src.err != nil {
+		// The source failed, not the backend
+		return stats, src.err
+	}
+
+	return stats, backendError(err)
+}
+
+// statementSource is a pgx.CopyFromSource of the statements returned by next until it returns nil or an error.
+type statementSource struct {
+	next     func() (*model.Statement, error)
+	values   func(*model.Statement) ([]interface{}, error)
+	current  *model.Statement
+	err      error
+	progress func(LoadProgress)
+
+	rows, total  int64
+	start, since time.Time
+}
+
+func newStatementSource(next func() (*model.Statement, error), total int64, progress func(LoadProgress)) *statementSource {
+	return &statementSource{next: next, progress: progress, total: total}
+}
+
+// Next implements the pgx.CopyFromSource interface.
+func (s *statementSource) Next() bool {
+	if s.progress != nil && s.rows%progressCheckRows == 0 && time.Since(s.since) >= progressInterval {
+		s.since = time.Now()
+		s.progress(LoadProgress{Rows: s.rows, Total: s.total, Elapsed: s.since.Sub(s.start)})
+	}
+
+	if s.current, s.err = s.next(); s.current == nil || s.err != nil {
+		return false
+	}
+
+	s.rows++
+
+	return true
+}
+
+// Values implements the pgx.CopyFromSource interface.
+func (s *statementSource) Values() ([]interface{}, error) {
+	return s.values(s.current)
+}
+
+// Err implements the pgx.CopyFromSource interface.
+func (s *statementSource) Err() error { return s.err }
+
+func actionStrings(actions []action.Action) []string {
+	res := make([]string, len(actions))
+	for i := range actions {
+		res[i] = string(actions[i])
+	}
+
+	return res
+}
+
+func krnStrings(krns []*krn.KRN) []string {
+	res := make([]string, len(krns))
+	for i := range krns {
+		res[i] = krns[i].String()
+	}
+
+	return res
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/config"
+	"time"
+)
+
+// ConnectionLatency holds latencies of the same query run over fresh (cold) and pooled (warm) connections.
+type ConnectionLatency struct {
+	Cold []time.Duration
+	Warm []time.Duration
+}
+
+// MeasureConnectionLatency runs the exists query iterations times on a newly opened client each (cold), which includes
+// the connection setup, and then iterations times on the long-lived client whose pool is already established (warm).
+func MeasureConnectionLatency(ctx context.Context, client *Client, cfg config.Database, request *EvaluatePermissionRequest, iterations int) (*ConnectionLatency, error) {
+	res := &ConnectionLatency{
+		Cold: make([]time.Duration, 0, iterations),
+		Warm: make([]time.Duration, 0, iterations),
+	}
+
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+
+		coldClient, err := NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = NewPostgresStore(coldClient).Exists(ctx, request)
+		res.Cold = append(res.Cold, time.Since(start))
+
+		if closeErr := coldClient.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	warmStore := NewPostgresStore(client)
+
+	// Establish the pooled connection before measuring
+	if _, err := warmStore.Exists(ctx, request); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+
+		if _, err := warmStore.Exists(ctx, request); err != nil {
+			return nil, err
+		}
+
+		res.Warm = append(res.Warm, time.Since(start))
+	}
+
+	return res, nil
+}
@@ -1,66 +1,125 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"iam-performance-test/config"
 	"iam-performance-test/model"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// Client is a long-lived PostgreSQL connection pool. Create it once and share it between queries.
 type Client struct {
 	Client *gorm.DB
 }
 
-func NewClient() (*Client, error) {
-	dsn := "host=localhost user=iam-perf password=root dbname=iam-perf port=5432 sslmode=disable TimeZone=Europe/Kiev"
+// NewClient opens a PostgreSQL connection pool configured by cfg.
+func NewClient(cfg config.Database) (*Client, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel(cfg.LogLevel))})
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info)})
+	if err != nil {
+		return nil, backendError(err)
+	}
 
+	sqlDB, err := db.DB()
 	if err != nil {
-		return nil, err
+		return nil, backendError(err)
 	}
 
+	sqlDB.SetMaxOpenConns(cfg.Pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Pool.ConnMaxLifetime.Duration)
+	sqlDB.SetConnMaxIdleTime(cfg.Pool.ConnMaxIdleTime.Duration)
+
 	return &Client{
 		Client: db,
 	}, nil
 }
 
+// Close closes all pooled connections.
+func (c *Client) Close() error {
+	db, err := c.Client.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
 // CloseDB  DB connection.
 func (c *Client) CloseDB() {
-	var (
-		db  *sql.DB
-		err error
-	)
-
-	if db, err = c.Client.DB(); err != nil {
-		fmt.Errorf("Error getting DB instance")
+	if err := c.Close(); err != nil {
+		fmt.Printf("Error disconnecting PostgreSQL: %v\n", err)
+		return
 	}
 
-	if err = db.Close(); err != nil {
-		fmt.Errorf("Error disconnecting PostgreSQL")
+	fmt.Println("db instance successfully closed")
+}
+
+// Stats returns the connection pool statistics.
+func (c *Client) Stats() sql.DBStats {
+	db, err := c.Client.DB()
+	if err != nil {
+		return sql.DBStats{}
 	}
 
-	fmt.Errorf("db instance successfully closed")
+	return db.Stats()
 }
 
-func (c *Client) Migrate() (err error) {
-	defer c.CloseDB()
+// ServerVersion returns the PostgreSQL server version, e.g. "14.5".
+func (c *Client) ServerVersion(ctx context.Context) (string, error) {
+	var version string
 
+	err := c.Client.WithContext(ctx).Raw("show server_version").Scan(&version).Error
+
+	return version, backendError(err)
+}
+
+// TableSize is the on-disk size of a table in bytes.
+type TableSize struct {
+	Table   int64
+	Indexes int64
+	Total   int64
+}
+
+// TableSize returns the size of the table, including its TOAST data, and of its indexes.
+func (c *Client) TableSize(ctx context.Context, table string) (TableSize, error) {
+	var size TableSize
+
+	err := c.Client.WithContext(ctx).Raw("select pg_table_size(t.oid) as \"table\", pg_indexes_size(t.oid) as indexes, "+
+		"pg_total_relation_size(t.oid) as total from (select ?::text::regclass as oid) t", table).Scan(&size).Error
+
+	return size, backendError(err)
+}
+
+// Migrate creates the statements table and its indexes. The client stays open afterwards.
+func (c *Client) Migrate() (err error) {
 	if err = c.Client.AutoMigrate(&model.Statement{}); err != nil {
 		return err
 	}
 
 	if err = c.CreateStatementGinIndexes(); err != nil {
-		fmt.Errorf("Error creating a PostgreSQL statement gin indexes: %v", err)
+		fmt.Printf("Error creating a PostgreSQL statement gin indexes: %v\n", err)
 	}
 
 	return nil
 }
 
+// statementIndexes are the indexes created by CreateStatementGinIndexes.
+var statementIndexes = []string{"idx_gin_statement_actions", "idx_gin_statement_resources", "idx_gin_statement_principals",
+	"idx_hash_statement_type"}
+
+// DropStatementIndexes drops the indexes created by CreateStatementGinIndexes.
+func (c *Client) DropStatementIndexes(ctx context.Context) error {
+	return backendError(c.Client.WithContext(ctx).Exec("DROP INDEX IF EXISTS " + strings.Join(statementIndexes, ", ") + ";").Error)
+}
+
 func (c *Client) CreateStatementGinIndexes() error {
 	if err := c.Client.Exec("CREATE INDEX IF NOT EXISTS idx_gin_statement_actions ON statements USING GIN (actions);").Error; err != nil {
 		return err
@@ -80,3 +139,16 @@ func (c *Client) CreateStatementGinIndexes() error {
 
 	return nil
 }
+
+func logLevel(level string) logger.LogLevel {
+	switch level {
+	case config.LogLevelSilent:
+		return logger.Silent
+	case config.LogLevelError:
+		return logger.Error
+	case config.LogLevelWarn:
+		return logger.Warn
+	}
+
+	return logger.Info
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNoMatchingStatement is returned when a statement looked up by ID does not exist.
+	// Searches never return it: no match is a valid result and is reported as false or an empty slice.
+	ErrNoMatchingStatement = errors.New("no matching statement")
+	// ErrBackendUnavailable is matched by every BackendError, e.g. connection failures, timeouts and cancellations.
+	ErrBackendUnavailable = errors.New("backend unavailable")
+	// ErrMalformedRequest is returned for requests that cannot be evaluated, e.g. with invalid actions or KRNs.
+	ErrMalformedRequest = errors.New("malformed request")
+	// ErrMalformedSnapshot is returned for statement snapshots that cannot be imported, e.g. truncated ones.
+	ErrMalformedSnapshot = errors.New("malformed snapshot")
+)
+
+// BackendError is a storage failure. The result of the failed call must not be treated as a decision.
+//
+// errors.Is(err, ErrBackendUnavailable) is true for any BackendError, while errors.Is and errors.As also see the
+// underlying error, e.g. context.DeadlineExceeded.
+type BackendError struct {
+	Err error
+}
+
+func (e *BackendError) Error() string { return ErrBackendUnavailable.Error() + ": " + e.Err.Error() }
+
+func (e *BackendError) Unwrap() error { return e.Err }
+
+func (e *BackendError) Is(target error) bool { return target == ErrBackendUnavailable }
+
+// backendError wraps err into a BackendError unless it is nil or already classified.
+func backendError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNoMatchingStatement), errors.Is(err, ErrBackendUnavailable), errors.Is(err, ErrMalformedRequest):
+		return err
+	}
+
+	return &BackendError{Err: err}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+)
+
+// Decision is the outcome of a permission evaluation.
+// The zero value is ImplicitDeny, so an unset Decision never grants access.
+type Decision int
+
+const (
+	// ImplicitDeny means no statement matched: access is denied by default.
+	ImplicitDeny Decision = iota
+	// Allow means at least one Allow statement and no Deny statement matched.
+	Allow
+	// ExplicitDeny means a Deny statement matched, which overrides any matching Allow statements.
+	ExplicitDeny
+)
+
+// String returns the human-readable Decision representation.
+func (d Decision) String() string {
+	switch d {
+	case ImplicitDeny:
+		return "ImplicitDeny"
+	case Allow:
+		return "Allow"
+	case ExplicitDeny:
+		return "ExplicitDeny"
+	}
+
+	return fmt.Sprintf("Decision(%d)", int(d))
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d Decision) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *Decision) UnmarshalText(text []byte) error {
+	for _, decision := range []Decision{ImplicitDeny, Allow, ExplicitDeny} {
+		if decision.String() == string(text) {
+			*d = decision
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown decision %q", text)
+}
+
+// IsAllowed returns whether the Decision grants access.
+func (d Decision) IsAllowed() bool { return d == Allow }
+
+// Evaluate decides whether principal may perform act on resource using explicit-deny-overrides-allow and default-deny
+// semantics over the statement types.
+//
+// A non-nil error means no decision was made; the returned Decision is then ImplicitDeny and the caller must fail
+// closed.
+func Evaluate(ctx context.Context, store StatementStore, principal *krn.KRN, act action.Action, resource *krn.KRN) (Decision, error) {
+	request, err := newEvaluationRequest(principal, act, resource)
+	if err != nil {
+		return ImplicitDeny, err
+	}
+
+	types, err := store.SearchStatementTypes(ctx, request)
+	if err != nil {
+		return ImplicitDeny, err
+	}
+
+	return decide(types), nil
+}
+
+// EvaluationTuple is a single (principal, action, resource) permission question.
+type EvaluationTuple struct {
+	Principal *krn.KRN
+	Action    action.Action
+	Resource  *krn.KRN
+}
+
+// BatchEvaluate is Evaluate for many tuples at once. The PostgreSQL store answers all of them in a single round trip.
+// Decisions are returned in the order of tuples.
+//
+// A non-nil error means no decisions were made and the caller must fail closed for every tuple.
+func BatchEvaluate(ctx context.Context, store StatementStore, tuples []EvaluationTuple) ([]Decision, error) {
+	requests := make([]*EvaluatePermissionRequest, len(tuples))
+
+	for i := range tuples {
+		request, err := newEvaluationRequest(tuples[i].Principal, tuples[i].Action, tuples[i].Resource)
+		if err != nil {
+			return nil, fmt.Errorf("tuple %d: %w", i, err)
+		}
+
+		requests[i] = request
+	}
+
+	types, err := store.BatchSearchStatementTypes(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]Decision, len(tuples))
+	for i := range types {
+		decisions[i] = decide(types[i])
+	}
+
+	return decisions, nil
+}
+
+// newEvaluationRequest builds the request matching all statements that apply to a single (principal, action, resource)
+// tuple.
+func newEvaluationRequest(principal *krn.KRN, act action.Action, resource *krn.KRN) (*EvaluatePermissionRequest, error) {
+	switch {
+	case principal == nil:
+		return nil, fmt.Errorf("%w: principal is required", ErrMalformedRequest)
+	case resource == nil:
+		return nil, fmt.Errorf("%w: resource is required", ErrMalformedRequest)
+	case !act.IsValid():
+		return nil, fmt.Errorf("%w: invalid action %q", ErrMalformedRequest, string(act))
+	}
+
+	return &EvaluatePermissionRequest{
+		Actions:    act.MatchingActionsString(),
+		Resources:  resource.MatchingKRNs(),
+		Principals: principal.MatchingKRNs(),
+	}, nil
+}
+
+// decide applies deny-overrides to the types of matching statements.
+func decide(types []string) Decision {
+	res := ImplicitDeny
+
+	for _, t := range types {
+		switch t {
+		case model.Deny:
+			return ExplicitDeny
+		case model.Allow:
+			res = Allow
+		}
+	}
+
+	return res
+}
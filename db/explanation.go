@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"strconv"
+	"strings"
+)
+
+// Explanation is an evaluation Decision together with the statements that produced it.
+type Explanation struct {
+	Decision Decision `json:"decision"`
+	// Allows are the matching Allow statements. They do not grant access when any Deny statement matched.
+	Allows []StatementMatch `json:"allows,omitempty"`
+	// Denies are the matching Deny statements.
+	Denies []StatementMatch `json:"denies,omitempty"`
+}
+
+// StatementMatch is a statement matching an evaluation along with its values that matched.
+//
+// Action, Resource and Principal are the most specific statement values that matched, e.g. "krn:svc:tenant::*" when
+// a resource only matched via the tenant wildcard.
+type StatementMatch struct {
+	StatementID uint   `json:"statementId"`
+	Type        string `json:"type"`
+	Action      string `json:"action"`
+	Resource    string `json:"resource"`
+	Principal   string `json:"principal"`
+	// OverriddenBy is the ID of the Deny statement that overrode this Allow statement, or 0.
+	OverriddenBy uint `json:"overriddenBy,omitempty"`
+}
+
+// Explain is Evaluate that also reports the matching statements. It is slower than Evaluate, as it fetches whole
+// statements rather than their types only.
+func Explain(ctx context.Context, store StatementStore, principal *krn.KRN, act action.Action, resource *krn.KRN) (*Explanation, error) {
+	request, err := newEvaluationRequest(principal, act, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	statements, err := store.SearchStatements(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Explanation{}
+
+	for i := range statements {
+		match := newStatementMatch(&statements[i], request)
+
+		switch match.Type {
+		case model.Deny:
+			res.Denies = append(res.Denies, match)
+		case model.Allow:
+			res.Allows = append(res.Allows, match)
+		}
+	}
+
+	switch {
+	case len(res.Denies) > 0:
+		res.Decision = ExplicitDeny
+
+		for i := range res.Allows {
+			res.Allows[i].OverriddenBy = res.Denies[0].StatementID
+		}
+	case len(res.Allows) > 0:
+		res.Decision = Allow
+	}
+
+	return res, nil
+}
+
+// String returns a single-line explanation suitable for audit logs.
+func (e *Explanation) String() string {
+	var res strings.Builder
+
+	res.WriteString(e.Decision.String())
+
+	for _, matches := range [][]StatementMatch{e.Denies, e.Allows} {
+		for i := range matches {
+			res.WriteString("; ")
+			res.WriteString(matches[i].String())
+		}
+	}
+
+	return res.String()
+}
+
+// String returns the human-readable StatementMatch representation.
+func (m *StatementMatch) String() string {
+	res := m.Type + " #" + strconv.FormatUint(uint64(m.StatementID), 10) +
+		" (action " + m.Action + ", resource " + m.Resource + ", principal " + m.Principal + ")"
+
+	if m.OverriddenBy != 0 {
+		res += " overridden by Deny #" + strconv.FormatUint(uint64(m.OverriddenBy), 10)
+	}
+
+	return res
+}
+
+func newStatementMatch(statement *model.Statement, request *EvaluatePermissionRequest) StatementMatch {
+	actions := make(stringSet, len(statement.Actions))
+	for i := range statement.Actions {
+		actions.add(statement.Actions[i].String())
+	}
+
+	return StatementMatch{
+		StatementID: statement.ID,
+		Type:        statement.Type,
+		Action:      firstContained(request.Actions, actions),
+		Resource:    firstContained(request.Resources, krnSet(statement.Resources)),
+		Principal:   firstContained(request.Principals, krnSet(statement.Principals)),
+	}
+}
+
+// firstContained returns the first of values contained in set. Matching values are ordered from the most specific
+// one, so this is the most specific statement value that matched.
+func firstContained(values []string, set stringSet) string {
+	for _, value := range values {
+		if set.contains(value) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func krnSet(krns []*krn.KRN) stringSet {
+	set := make(stringSet, len(krns))
+	for _, k := range krns {
+		set.add(k.String())
+	}
+
+	return set
+}
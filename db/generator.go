@@ -0,0 +1,277 @@
+package db
+
+import (
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// actionService is the service of generated actions.
+	actionService = "iam"
+	// principalType is the resource type of generated principals.
+	principalType = "user"
+	nameLength    = 10
+	// pathTokenCount is the number of distinct resource path sub-tokens.
+	pathTokenCount = 10
+)
+
+// operations are granted in this order, so a statement granting n operations grants the first n.
+var operations = [config.MaxActionCount]string{"read", "write", "delete", "create", "update", "list"}
+
+var resourceTypes = [config.MaxResourceTypeCount]string{
+	"endpoint", "device", "application", "gateway", "group", "policy", "role", "dashboard", "report", "integration",
+}
+
+// wildcardLevel is a KRN level of a generated wildcard.
+type wildcardLevel int
+
+const (
+	serviceLevel wildcardLevel = iota
+	tenantLevel
+	poolLevel
+	resourceTypeLevel
+	resourceIDLevel
+)
+
+// Generator generates the statements of a dataset service by service. All randomness comes from a source seeded with
+// the dataset seed, so generators of equal datasets generate identical statements in the same order.
+type Generator struct {
+	dataset config.Dataset
+	rng     *rand.Rand
+
+	tenants, resources, principals, actions, ids *sampler
+
+	services    int // Number of started services
+	service     string
+	tenantNames []string
+	statement   int // Index of the next statement of the service
+}
+
+// NewGenerator constructs a generator of a valid dataset.
+func NewGenerator(dataset config.Dataset) *Generator {
+	rng := rand.New(rand.NewSource(dataset.Seed))
+
+	return &Generator{
+		dataset:    dataset,
+		rng:        rng,
+		tenants:    newSampler(rng, dataset.TenantDistribution, dataset.TenantCount, dataset.ZipfSkew),
+		resources:  newSampler(rng, dataset.ResourceDistribution, dataset.ResourceCount, dataset.ZipfSkew),
+		principals: newSampler(rng, dataset.PrincipalDistribution, dataset.PrincipalCount, dataset.ZipfSkew),
+		actions:    newSampler(rng, dataset.ActionDistribution, dataset.ActionCount, dataset.ZipfSkew),
+		ids:        newSampler(rng, dataset.IDDistribution, dataset.IDCount, dataset.ZipfSkew),
+	}
+}
+
+// Next returns the next statement, or nil after the last statement of the dataset.
+func (g *Generator) Next() *model.Statement {
+	if g.services == 0 || g.statement == g.dataset.StatementCount {
+		if g.services == g.dataset.ServiceCount {
+			return nil
+		}
+
+		g.startService()
+	}
+
+	g.statement++
+
+	tenant := g.tenant()
+	resourceType := resourceTypes[g.rng.Intn(g.dataset.ResourceTypeCount)]
+
+	actions := make([]action.Action, g.actions.count())
+	for i := range actions {
+		actions[i] = action.Action(actionService + ":" + resourceType + ":" + operations[i])
+	}
+
+	var levels []wildcardLevel
+
+	for _, w := range []struct {
+		level wildcardLevel
+		ratio float64
+	}{
+		{serviceLevel, g.dataset.Wildcards.Service},
+		{tenantLevel, g.dataset.Wildcards.Tenant},
+		{poolLevel, g.dataset.Wildcards.Pool},
+		{resourceTypeLevel, g.dataset.Wildcards.ResourceType},
+		{resourceIDLevel, g.dataset.Wildcards.ResourceID},
+	} {
+		if g.rng.Float64() < w.ratio {
+			levels = append(levels, w.level)
+		}
+	}
+
+	statementType := model.Allow
+	if g.rng.Float64() < g.dataset.DenyRatio {
+		statementType = model.Deny
+	}
+
+	return &model.Statement{
+		Type:       statementType,
+		Actions:    actions,
+		Resources:  g.krns(g.resources.count(), tenant, resourceType, levels),
+		Principals: g.krns(g.principals.count(), tenant, principalType, levels),
+	}
+}
+
+// Service returns the name of the service of the last statement.
+func (g *Generator) Service() string { return g.service }
+
+func (g *Generator) startService() {
+	g.services++
+	g.statement = 0
+	g.service = g.name()
+
+	g.tenantNames = make([]string, g.dataset.TenantCount)
+	for i := range g.tenantNames {
+		g.tenantNames[i] = g.name()
+	}
+}
+
+func (g *Generator) tenant() string {
+	if len(g.tenantNames) == 0 {
+		return g.name()
+	}
+
+	return g.tenantNames[g.tenants.index()]
+}
+
+// krns returns count KRNs of the resource type, the first of which are wildcards at the given levels.
+func (g *Generator) krns(count int, tenant, resourceType string, levels []wildcardLevel) []*krn.KRN {
+	res := make([]*krn.KRN, count)
+
+	for i := range res {
+		prefix := "krn:" + g.service + ":" + tenant + ":"
+		pool := g.pool()
+
+		var s string
+
+		if i >= len(levels) {
+			s = prefix + pool + ":" + resourceType + g.path() + "/" + g.id(tenant)
+		} else {
+			switch levels[i] {
+			case serviceLevel:
+				s = "krn:" + g.service + ":*"
+			case tenantLevel:
+				s = prefix + "*"
+			case poolLevel:
+				s = prefix + "/*"
+			case resourceTypeLevel:
+				s = prefix + pool + ":*"
+			case resourceIDLevel:
+				s = prefix + pool + ":" + resourceType + g.path() + "/*"
+			}
+		}
+
+		k, err := krn.NewKRNFromString(s)
+		if err != nil {
+			panic(fmt.Sprintf("generated an invalid KRN %q: %v", s, err))
+		}
+
+		res[i] = k
+	}
+
+	return res
+}
+
+// pool returns the pool KRN token: empty for the root pool, or a root pool sub-pool like "/pool-2".
+func (g *Generator) pool() string {
+	if g.dataset.PoolCount == 0 {
+		return ""
+	}
+
+	if n := g.rng.Intn(g.dataset.PoolCount + 1); n > 0 {
+		return "/pool-" + strconv.Itoa(n)
+	}
+
+	return ""
+}
+
+// path returns up to PathDepth resource path sub-tokens preceded by slashes, e.g. "/path-3/path-0".
+func (g *Generator) path() string {
+	if g.dataset.PathDepth == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	for depth := g.rng.Intn(g.dataset.PathDepth + 1); depth > 0; depth-- {
+		b.WriteString("/path-")
+		b.WriteString(strconv.Itoa(g.rng.Intn(pathTokenCount)))
+	}
+
+	return b.String()
+}
+
+// id returns a unique random UUID, or one of IDCount UUIDs of the tenant.
+func (g *Generator) id(tenant string) string {
+	if g.dataset.IDCount == 0 {
+		id, _ := uuid.NewRandomFromReader(g.rng) // Reading from rand.Rand never fails
+
+		return id.String()
+	}
+
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(g.service+":"+tenant+":"+strconv.Itoa(g.ids.index()))).String()
+}
+
+func (g *Generator) name() string {
+	var letters = []rune("abcdefghijklmnopqrstuvwxyz")
+
+	s := make([]rune, nameLength)
+	for i := range s {
+		s[i] = letters[g.rng.Intn(len(letters))]
+	}
+
+	return string(s)
+}
+
+// sampler draws values from [0, n) following a distribution.
+type sampler struct {
+	distribution config.Distribution
+	n            int
+	rng          *rand.Rand
+	zipf         *rand.Zipf
+	next         int
+}
+
+func newSampler(rng *rand.Rand, distribution config.Distribution, n int, skew float64) *sampler {
+	s := &sampler{distribution: distribution, n: n, rng: rng}
+
+	if distribution == config.DistributionZipf && n > 1 {
+		s.zipf = rand.NewZipf(rng, skew, 1, uint64(n-1))
+	}
+
+	return s
+}
+
+// index returns a value in [0, n). Constant distributions cycle through all values.
+func (s *sampler) index() int {
+	switch {
+	case s.n <= 1:
+		return 0
+	case s.zipf != nil:
+		return int(s.zipf.Uint64())
+	case s.distribution == config.DistributionUniform:
+		return s.rng.Intn(s.n)
+	}
+
+	i := s.next
+	s.next = (s.next + 1) % s.n
+
+	return i
+}
+
+// count returns a count in [1, n]. Constant distributions always yield n.
+func (s *sampler) count() int {
+	if s.distribution == config.DistributionConstant {
+		return s.n
+	}
+
+	return s.index() + 1
+}
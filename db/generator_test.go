@@ -0,0 +1,91 @@
+package db
+
+import (
+	"fmt"
+	"iam-performance-test/config"
+	"reflect"
+	"testing"
+)
+
+// testDatasets are small datasets exercising every distribution, pools, paths and wildcards.
+func testDatasets() map[string]config.Dataset {
+	uniform := config.Default().Dataset
+	uniform.ServiceCount = 3
+	uniform.StatementCount = 50
+
+	zipf := uniform
+	zipf.TenantCount = 5
+	zipf.TenantDistribution = config.DistributionZipf
+	zipf.ResourceDistribution = config.DistributionZipf
+	zipf.PrincipalDistribution = config.DistributionUniform
+	zipf.ActionDistribution = config.DistributionZipf
+	zipf.ResourceTypeCount = 3
+	zipf.PoolCount = 2
+	zipf.PathDepth = 2
+	zipf.IDCount = 20
+	zipf.IDDistribution = config.DistributionZipf
+	zipf.DenyRatio = 0.3
+	zipf.Wildcards = config.Wildcards{Service: 0.1, Tenant: 0.1, Pool: 0.1, ResourceType: 0.1, ResourceID: 0.1}
+
+	return map[string]config.Dataset{"default": uniform, "zipf": zipf}
+}
+
+// generate returns the statements of the dataset as strings prefixed with their service.
+func generate(dataset config.Dataset) []string {
+	var res []string
+
+	g := NewGenerator(dataset)
+	for statement := g.Next(); statement != nil; statement = g.Next() {
+		res = append(res, fmt.Sprintf("%s %s %v %v %v", g.Service(), statement.Type, statement.Actions,
+			krnStrings(statement.Resources), krnStrings(statement.Principals)))
+	}
+
+	return res
+}
+
+func TestGeneratorSameSeed(t *testing.T) {
+	for name, dataset := range testDatasets() {
+		cfg := config.Default()
+		cfg.Dataset = dataset
+
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		first := generate(dataset)
+
+		if want := dataset.ServiceCount * dataset.StatementCount; len(first) != want {
+			t.Fatalf("%s: generated %d statements, want %d", name, len(first), want)
+		}
+
+		if second := generate(dataset); !reflect.DeepEqual(first, second) {
+			t.Errorf("%s: seed %d generated different statements", name, dataset.Seed)
+		}
+	}
+}
+
+func TestGeneratorDifferentSeed(t *testing.T) {
+	for name, dataset := range testDatasets() {
+		first := generate(dataset)
+
+		dataset.Seed++
+		second := generate(dataset)
+
+		if reflect.DeepEqual(first, second) {
+			t.Errorf("%s: seeds %d and %d generated the same statements", name, dataset.Seed-1, dataset.Seed)
+		}
+
+		same := 0
+		for i := range first {
+			if first[i] == second[i] {
+				same++
+			}
+		}
+
+		// Shared statements would be a stream partly independent of the seed
+		if same > 0 {
+			t.Errorf("%s: seeds %d and %d generated %d equal statements out of %d", name, dataset.Seed-1, dataset.Seed,
+				same, len(first))
+		}
+	}
+}
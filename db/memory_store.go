@@ -0,0 +1,409 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/model"
+	"iam-performance-test/service/krn"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a StatementStore keeping statements in process memory. It requires no database and is safe for
+// concurrent use.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	nextID     uint
+	statements []*model.Statement // Ordered by ID
+}
+
+// ctxCheckInterval is the number of statements scanned between context cancellation checks.
+const ctxCheckInterval = 1024
+
+// NewMemoryStore constructs an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, statements []*model.Statement) error {
+	if err := ctx.Err(); err != nil {
+		return backendError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, statement := range statements {
+		s.nextID++
+		statement.ID = s.nextID
+
+		s.statements = append(s.statements, copyStatement(statement))
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id uint) (*model.Statement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, backendError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.indexOf(id)
+	if !ok {
+		return nil, ErrNoMatchingStatement
+	}
+
+	return copyStatement(s.statements[i]), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, offset, limit int) (model.Statements, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, backendError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	end := len(s.statements)
+
+	if offset > end {
+		offset = end
+	}
+
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	statements := make(model.Statements, 0, end-offset)
+	for _, statement := range s.statements[offset:end] {
+		statements = append(statements, *copyStatement(statement))
+	}
+
+	return statements, nil
+}
+
+func (s *MemoryStore) ListAfter(ctx context.Context, afterID uint, limit int) (model.Statements, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, backendError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start, ok := s.indexOf(afterID)
+	if ok {
+		start++
+	}
+
+	end := len(s.statements)
+
+	if limit >= 0 && start+limit < end {
+		end = start + limit
+	}
+
+	statements := make(model.Statements, 0, end-start)
+	for _, statement := range s.statements[start:end] {
+		statements = append(statements, *copyStatement(statement))
+	}
+
+	return statements, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return backendError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.indexOf(id)
+	if !ok {
+		return ErrNoMatchingStatement
+	}
+
+	s.statements = append(s.statements[:i], s.statements[i+1:]...)
+
+	return nil
+}
+
+func (s *MemoryStore) Exists(ctx context.Context, request *EvaluatePermissionRequest) (bool, error) {
+	var isExists bool
+
+	err := s.search(ctx, request, func(*model.Statement) bool {
+		isExists = true
+
+		return false
+	})
+
+	return isExists, err
+}
+
+func (s *MemoryStore) SearchStatements(ctx context.Context, request *EvaluatePermissionRequest) (model.Statements, error) {
+	var statements model.Statements
+
+	err := s.search(ctx, request, func(statement *model.Statement) bool {
+		statements = append(statements, *copyStatement(statement))
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return statements, nil
+}
+
+func (s *MemoryStore) SearchStatementTypes(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	types := make(stringSet)
+
+	err := s.search(ctx, request, func(statement *model.Statement) bool {
+		types.add(statement.Type)
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return types.slice(), nil
+}
+
+func (s *MemoryStore) BatchSearchStatementTypes(ctx context.Context, requests []*EvaluatePermissionRequest) ([][]string, error) {
+	return batchSearchStatementTypes(ctx, s, requests)
+}
+
+func (s *MemoryStore) SearchStatementIds(ctx context.Context, request *EvaluatePermissionRequest) ([]uint64, error) {
+	var statementIds []uint64
+
+	err := s.search(ctx, request, func(statement *model.Statement) bool {
+		statementIds = append(statementIds, uint64(statement.ID))
+
+		return true
+	})
+
+	return statementIds, err
+}
+
+func (s *MemoryStore) SearchResources(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	resources := make(stringSet)
+
+	err := s.search(ctx, request, func(statement *model.Statement) bool {
+		for _, resource := range statement.Resources {
+			resources.add(resource.String())
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resources.slice(), nil
+}
+
+func (s *MemoryStore) SearchResourcesGroupingByType(ctx context.Context, request *EvaluatePermissionRequest) ([]string, []string, error) {
+	allowed, denied := make(stringSet), make(stringSet)
+
+	err := s.search(ctx, request, func(statement *model.Statement) bool {
+		resources := denied
+		if statement.Type == model.Allow {
+			resources = allowed
+		}
+
+		for _, resource := range statement.Resources {
+			resources.add(resource.String())
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return allowed.slice(), denied.slice(), nil
+}
+
+func (s *MemoryStore) SearchPrincipals(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	principals := make(stringSet)
+
+	err := s.search(ctx, request, func(statement *model.Statement) bool {
+		for _, principal := range statement.Principals {
+			principals.add(principal.String())
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return principals.slice(), nil
+}
+
+func (s *MemoryStore) CountByType(ctx context.Context) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, backendError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, statement := range s.statements {
+		counts[statement.Type]++
+	}
+
+	return counts, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return backendError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID, s.statements = 0, nil
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+// search calls fn for every statement matching the request in ID order until fn returns false or ctx is done.
+func (s *MemoryStore) search(ctx context.Context, request *EvaluatePermissionRequest, fn func(statement *model.Statement) bool) error {
+	actions, resources, principals := newStringSet(request.Actions), newStringSet(request.Resources), newStringSet(request.Principals)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i, statement := range s.statements {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return backendError(err)
+			}
+		}
+
+		if request.Type != "" && statement.Type != request.Type {
+			continue
+		}
+
+		if !actions.overlapsActions(statement) || !resources.overlapsKRNs(statement.Resources) || !principals.overlapsKRNs(statement.Principals) {
+			continue
+		}
+
+		if !fn(statement) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) indexOf(id uint) (int, bool) {
+	i := sort.Search(len(s.statements), func(i int) bool { return s.statements[i].ID >= id })
+
+	return i, i < len(s.statements) && s.statements[i].ID == id
+}
+
+type stringSet map[string]void
+
+type void struct{}
+
+// newStringSet returns nil for empty values, which overlaps with anything like an omitted request filter.
+func newStringSet(values []string) stringSet {
+	if len(values) == 0 {
+		return nil
+	}
+
+	set := make(stringSet, len(values))
+	for _, value := range values {
+		set.add(value)
+	}
+
+	return set
+}
+
+func (set stringSet) add(value string) { set[value] = void{} }
+
+func (set stringSet) contains(value string) bool {
+	_, ok := set[value]
+
+	return ok
+}
+
+// copyStatement returns a copy of the statement sharing neither its slices nor its KRNs, so stored statements change
+// only through the store, as rows of the other backends do.
+func copyStatement(statement *model.Statement) *model.Statement {
+	res := *statement
+	res.Actions = append(statement.Actions[:0:0], statement.Actions...)
+	res.Resources = copyKRNs(statement.Resources)
+	res.Principals = copyKRNs(statement.Principals)
+
+	return &res
+}
+
+func copyKRNs(krns []*krn.KRN) []*krn.KRN {
+	if krns == nil {
+		return nil
+	}
+
+	res := make([]*krn.KRN, len(krns))
+
+	for i, k := range krns {
+		if k != nil {
+			c := *k
+			res[i] = &c
+		}
+	}
+
+	return res
+}
+
+func (set stringSet) overlapsActions(statement *model.Statement) bool {
+	if set == nil {
+		return true
+	}
+
+	for i := range statement.Actions {
+		if set.contains(statement.Actions[i].String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (set stringSet) overlapsKRNs(krns []*krn.KRN) bool {
+	if set == nil {
+		return true
+	}
+
+	for _, k := range krns {
+		if set.contains(k.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (set stringSet) slice() []string {
+	res := make([]string, 0, len(set))
+	for value := range set {
+		res = append(res, value)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
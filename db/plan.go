@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// QueryPlan is the executed plan of a query as reported by EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON).
+type QueryPlan struct {
+	SQL string `json:"sql"`
+	// Plan is the raw JSON output of EXPLAIN.
+	Plan  json.RawMessage `json:"plan"`
+	Facts PlanFacts       `json:"facts"`
+}
+
+// PlanFacts are the key facts of a QueryPlan.
+type PlanFacts struct {
+	// Shape is the tree of plan node types along with their relations and indexes, e.g.
+	// "Aggregate(Bitmap Heap Scan on statements(Bitmap Index Scan using idx_gin_statement_resources))". Plans of equal
+	// shape only differ in their estimates and timings.
+	Shape string `json:"shape"`
+	// Indexes are the distinct indexes scanned, and SeqScans the distinct relations scanned sequentially.
+	Indexes  []string `json:"indexes,omitempty"`
+	SeqScans []string `json:"seqScans,omitempty"`
+	// EstimatedRows and ActualRows are the rows of the plan root node, the latter summed over all its loops.
+	EstimatedRows float64 `json:"estimatedRows"`
+	ActualRows    float64 `json:"actualRows"`
+	// SharedHitBlocks and SharedReadBlocks are the shared buffer blocks found in the cache and read from disk.
+	SharedHitBlocks  int64 `json:"sharedHitBlocks"`
+	SharedReadBlocks int64 `json:"sharedReadBlocks"`
+	// PlanningTime and ExecutionTime are in milliseconds.
+	PlanningTime  float64 `json:"planningTime"`
+	ExecutionTime float64 `json:"executionTime"`
+}
+
+// planNode is a node of the EXPLAIN JSON format.
+type planNode struct {
+	NodeType         string     `json:"Node Type"`
+	RelationName     string     `json:"Relation Name"`
+	IndexName        string     `json:"Index Name"`
+	PlanRows         float64    `json:"Plan Rows"`
+	ActualRows       float64    `json:"Actual Rows"`
+	ActualLoops      float64    `json:"Actual Loops"`
+	SharedHitBlocks  int64      `json:"Shared Hit Blocks"`
+	SharedReadBlocks int64      `json:"Shared Read Blocks"`
+	Plans            []planNode `json:"Plans"`
+}
+
+// ExplainAnalyze executes the query with EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) and returns its plan. The query runs
+// for real, so it must not modify any data.
+func (s *PostgresStore) ExplainAnalyze(ctx context.Context, query Query) (*QueryPlan, error) {
+	var plan []byte
+
+	explain := Query{SQL: "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) " + query.SQL, Args: query.Args}
+
+	row := rawQuery(s.client.Client.WithContext(ctx), explain).Row()
+	if err := row.Scan(&plan); err != nil {
+		return nil, backendError(err)
+	}
+
+	facts, err := ParsePlan(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryPlan{SQL: query.SQL, Plan: plan, Facts: facts}, nil
+}
+
+// ParsePlan extracts the facts of a plan in the EXPLAIN JSON format.
+func ParsePlan(plan []byte) (PlanFacts, error) {
+	var explained []struct {
+		Plan          planNode `json:"Plan"`
+		PlanningTime  float64  `json:"Planning Time"`
+		ExecutionTime float64  `json:"Execution Time"`
+	}
+
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return PlanFacts{}, fmt.Errorf("parsing plan: %w", err)
+	}
+
+	if len(explained) != 1 {
+		return PlanFacts{}, fmt.Errorf("parsing plan: %d plans instead of 1", len(explained))
+	}
+
+	root := &explained[0].Plan
+
+	res := PlanFacts{
+		EstimatedRows: root.PlanRows,
+		ActualRows:    root.ActualRows * root.ActualLoops,
+		// Buffer counts of a node include those of its children
+		SharedHitBlocks:  root.SharedHitBlocks,
+		SharedReadBlocks: root.SharedReadBlocks,
+		PlanningTime:     explained[0].PlanningTime,
+		ExecutionTime:    explained[0].ExecutionTime,
+	}
+
+	indexes, seqScans := make(stringSet), make(stringSet)
+
+	b := &strings.Builder{}
+	root.walk(b, indexes, seqScans)
+
+	res.Shape = b.String()
+	res.Indexes = indexes.slice()
+	res.SeqScans = seqScans.slice()
+
+	return res, nil
+}
+
+// walk writes the shape of the node tree and collects its indexes and sequentially scanned relations.
+func (n *planNode) walk(shape *strings.Builder, indexes, seqScans stringSet) {
+	shape.WriteString(n.NodeType)
+
+	if n.RelationName != "" {
+		shape.WriteString(" on " + n.RelationName)
+	}
+
+	if n.IndexName != "" {
+		shape.WriteString(" using " + n.IndexName)
+		indexes.add(n.IndexName)
+	}
+
+	if n.NodeType == "Seq Scan" {
+		seqScans.add(n.RelationName)
+	}
+
+	if len(n.Plans) == 0 {
+		return
+	}
+
+	shape.WriteByte('(')
+
+	for i := range n.Plans {
+		if i > 0 {
+			shape.WriteString(", ")
+		}
+
+		n.Plans[i].walk(shape, indexes, seqScans)
+	}
+
+	shape.WriteByte(')')
+}
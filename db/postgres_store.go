@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/model"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// batchEvaluationSize is the maximum number of requests searched by a single query, keeping it well below
+// the PostgreSQL limit of 65535 bound parameters.
+const batchEvaluationSize = 1000
+
+// PostgresStore is a StatementStore keeping statements in PostgreSQL tables of a Schema.
+type PostgresStore struct {
+	client *Client
+	schema Schema
+}
+
+// NewPostgresStore constructs a PostgresStore of the array schema, i.e. text[] columns backed by GIN indexes, on top of
+// an existing client.
+func NewPostgresStore(client *Client) *PostgresStore {
+	return NewSchemaStore(client, &arraySchema{client: client, arrayQueries: statementsQueries})
+}
+
+// NewSchemaStore constructs a PostgresStore of the schema, which must be constructed on top of the same client.
+func NewSchemaStore(client *Client, schema Schema) *PostgresStore {
+	return &PostgresStore{client: client, schema: schema}
+}
+
+// Schema returns the schema of the store.
+func (s *PostgresStore) Schema() Schema { return s.schema }
+
+func (s *PostgresStore) Create(ctx context.Context, statements []*model.Statement) error {
+	return s.schema.Insert(ctx, statements)
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id uint) (*model.Statement, error) {
+	var statements model.Statements
+
+	b := newQueryBuilder("select " + s.schema.Columns() + " from " + s.table() + " s where s.id = ")
+	if err := s.raw(ctx, b.append(b.bind(id)).build(), &statements); err != nil {
+		return nil, err
+	}
+
+	if len(statements) == 0 {
+		return nil, ErrNoMatchingStatement
+	}
+
+	return &statements[0], nil
+}
+
+func (s *PostgresStore) List(ctx context.Context, offset, limit int) (model.Statements, error) {
+	var statements model.Statements
+
+	b := newQueryBuilder("select " + s.schema.Columns() + " from " + s.table() + " s order by s.id offset ")
+	b.append(b.bind(offset)).limit(limit)
+
+	err := s.raw(ctx, b.build(), &statements)
+
+	return statements, err
+}
+
+func (s *PostgresStore) ListAfter(ctx context.Context, afterID uint, limit int) (model.Statements, error) {
+	var statements model.Statements
+
+	b := newQueryBuilder("select " + s.schema.Columns() + " from " + s.table() + " s where s.id > ")
+	b.append(b.bind(afterID) + " order by s.id").limit(limit)
+
+	err := s.raw(ctx, b.build(), &statements)
+
+	return statements, err
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id uint) error {
+	res := s.client.Client.WithContext(ctx).Exec("DELETE FROM "+s.table()+" WHERE id = ?", id)
+
+	switch {
+	case res.Error != nil:
+		return backendError(res.Error)
+	case res.RowsAffected == 0:
+		return ErrNoMatchingStatement
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) Exists(ctx context.Context, request *EvaluatePermissionRequest) (bool, error) {
+	var isExists bool
+
+	err := s.raw(ctx, s.schema.ExistQuery(request), &isExists)
+
+	return isExists, err
+}
+
+func (s *PostgresStore) SearchStatements(ctx context.Context, request *EvaluatePermissionRequest) (model.Statements, error) {
+	var statements model.Statements
+
+	err := s.raw(ctx, s.schema.StatementsQuery(request), &statements)
+
+	return statements, err
+}
+
+func (s *PostgresStore) SearchStatementTypes(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	var types []string
+
+	err := s.raw(ctx, s.schema.StatementTypesQuery(request), &types)
+
+	return types, err
+}
+
+func (s *PostgresStore) BatchSearchStatementTypes(ctx context.Context, requests []*EvaluatePermissionRequest) ([][]string, error) {
+	res := make([][]string, len(requests))
+
+	for start := 0; start < len(requests); start += batchEvaluationSize {
+		end := start + batchEvaluationSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		var rows []struct {
+			Idx  int
+			Type string
+		}
+
+		if err := s.raw(ctx, s.schema.BatchStatementTypesQuery(requests[start:end]), &rows); err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			res[start+row.Idx] = append(res[start+row.Idx], row.Type)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *PostgresStore) SearchStatementIds(ctx context.Context, request *EvaluatePermissionRequest) ([]uint64, error) {
+	var statementIds []uint64
+
+	err := s.raw(ctx, s.schema.StatementIdsQuery(request), &statementIds)
+
+	return statementIds, err
+}
+
+func (s *PostgresStore) SearchResources(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	var resources []string
+
+	err := s.raw(ctx, s.schema.ResourcesQuery(request), &resources)
+
+	return resources, err
+}
+
+func (s *PostgresStore) SearchResourcesGroupingByType(ctx context.Context, request *EvaluatePermissionRequest) ([]string, []string, error) {
+	krnToType := make([]map[string]interface{}, 0)
+
+	if err := s.raw(ctx, s.schema.ResourcesGroupingByTypeQuery(request), &krnToType); err != nil {
+		return nil, nil, err
+	}
+
+	allowed, denied := splitByType(krnToType)
+
+	return allowed, denied, nil
+}
+
+func (s *PostgresStore) SearchPrincipals(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	var principals []string
+
+	err := s.raw(ctx, s.schema.PrincipalsQuery(request), &principals)
+
+	return principals, err
+}
+
+func (s *PostgresStore) CountByType(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Type  string
+		Count int64
+	}
+
+	if err := s.raw(ctx, Query{SQL: "select s.type, count(*) as count from " + s.table() + " s group by s.type"}, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+
+	return counts, nil
+}
+
+// Reset truncates all tables of the schema.
+func (s *PostgresStore) Reset(ctx context.Context) error {
+	return backendError(s.client.Client.WithContext(ctx).Exec("TRUNCATE TABLE " + strings.Join(s.schema.Tables(), ", ") + " RESTART IDENTITY;").Error)
+}
+
+func (s *PostgresStore) Close() error {
+	return s.client.Close()
+}
+
+// Size returns the total size of the schema tables, including their TOAST data, and of their indexes.
+func (s *PostgresStore) Size(ctx context.Context) (TableSize, error) {
+	var res TableSize
+
+	for _, table := range s.schema.Tables() {
+		size, err := s.client.TableSize(ctx, table)
+		if err != nil {
+			return TableSize{}, err
+		}
+
+		res.Table += size.Table
+		res.Indexes += size.Indexes
+		res.Total += size.Total
+	}
+
+	return res, nil
+}
+
+// CountWrites runs write against a store of the same schema inside a single transaction and returns the number of
+// rows it inserted, updated or deleted in the schema tables, those written by triggers included, as counted by
+// pg_stat_xact_user_tables. Upserts count their conflicting rows as updates, and index entries are not counted.
+func (s *PostgresStore) CountWrites(ctx context.Context, write func(store StatementStore) error) (rows int64, err error) {
+	err = s.client.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		client := &Client{Client: tx}
+
+		schema, err := NewSchema(client, s.schema.Name())
+		if err != nil {
+			return err
+		}
+
+		if err = write(NewSchemaStore(client, schema)); err != nil {
+			return err
+		}
+
+		b := newQueryBuilder("select coalesce(sum(n_tup_ins + n_tup_upd + n_tup_del), 0) from pg_stat_xact_user_tables where relid = any(")
+		query := b.append(b.bind(textArray(s.schema.Tables())) + "::text[]::regclass[])").build()
+
+		return rawQuery(tx, query).Scan(&rows).Error
+	})
+
+	return rows, backendError(err)
+}
+
+// table returns the statements table of the schema.
+func (s *PostgresStore) table() string { return s.schema.Tables()[0] }
+
+// raw runs the query and scans its result into dest.
+func (s *PostgresStore) raw(ctx context.Context, query Query, dest interface{}) error {
+	return backendError(rawQuery(s.client.Client.WithContext(ctx), query).Scan(dest).Error)
+}
+
+// limit appends a limit clause unless limit is negative, which means no limit.
+func (b *queryBuilder) limit(limit int) *queryBuilder {
+	if limit < 0 {
+		return b
+	}
+
+	return b.append(" limit " + b.bind(limit))
+}
+
+// rawQuery returns db running the query verbatim. Unlike gorm.DB.Raw, it never parses the SQL for named arguments,
+// which would drop the positional arguments of queries using PostgreSQL operators like @@ or @>.
+func rawQuery(db *gorm.DB, query Query) *gorm.DB {
+	tx := db.Raw("")
+	tx.Statement.SQL.WriteString(query.SQL)
+	tx.Statement.Vars = append(tx.Statement.Vars, query.Args...)
+
+	return tx
+}
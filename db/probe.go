@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"os"
+	"path/filepath"
+)
+
+// ProbeService is the service of all probe KRNs. Generated service names are longer, so generated statements never
+// match probes, and probes never match generated resources.
+const ProbeService = "probe"
+
+const (
+	probeAction      = "iam:endpoint:read"
+	probeOtherAction = "iam:endpoint:write"
+)
+
+// Probe is an access request with a known decision, planted into every generated dataset.
+//
+// Every probe has its own tenant of the ProbeService, named after the probe, so the statements of one probe do not
+// affect the decisions of others.
+type Probe struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Action      string   `json:"action"`
+	Principal   string   `json:"principal"`
+	Resource    string   `json:"resource"`
+	Decision    Decision `json:"decision"`
+	// Statements is the number of statements matching the request.
+	Statements int `json:"statements"`
+
+	statements []probeStatement
+}
+
+// ProbeManifest lists the probes planted in a dataset.
+type ProbeManifest struct {
+	Dataset config.Dataset `json:"dataset"`
+	Probes  []Probe        `json:"probes"`
+}
+
+type probeStatement struct {
+	typ        string
+	actions    []string
+	resources  []string
+	principals []string
+}
+
+// Probes returns the planted probes. They are the same for every dataset.
+func Probes() []Probe {
+	res := []Probe{
+		{
+			Name:        "allowed",
+			Description: "allowed by an Allow statement for the exact principal and resource",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow}},
+		},
+		{
+			Name:        "explicit-deny",
+			Description: "denied by a Deny statement overriding an Allow one for the exact principal and resource",
+			Decision:    ExplicitDeny,
+			statements:  []probeStatement{{typ: model.Allow}, {typ: model.Deny}},
+		},
+		{
+			Name:        "implicit-deny",
+			Description: "denied by default as the only statement of the principal allows another resource",
+			Decision:    ImplicitDeny,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{probeKRN("implicit-deny", "endpoint/other")}}},
+		},
+		{
+			Name:        "other-action",
+			Description: "denied by default as the only statement of the principal allows another action",
+			Decision:    ImplicitDeny,
+			statements:  []probeStatement{{typ: model.Allow, actions: []string{probeOtherAction}}},
+		},
+		{
+			Name:        "action-wildcard",
+			Description: "allowed only via an action wildcard",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, actions: []string{"iam:endpoint:*"}}},
+		},
+		{
+			Name:        "service-wildcard",
+			Description: "allowed only via a service wildcard resource",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{"krn:" + ProbeService + ":*"}}},
+		},
+		{
+			Name:        "tenant-wildcard",
+			Description: "allowed only via a tenant wildcard resource",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{"krn:" + ProbeService + ":tenant-wildcard:*"}}},
+		},
+		{
+			Name:        "resource-type-wildcard",
+			Description: "allowed only via a resource type wildcard resource",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{probeKRN("resource-type-wildcard", "*")}}},
+		},
+		{
+			Name:        "resource-id-wildcard",
+			Description: "allowed only via a resource ID wildcard resource",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{probeKRN("resource-id-wildcard", "endpoint/*")}}},
+		},
+		{
+			Name:        "principal-wildcard",
+			Description: "allowed only via a wildcard principal",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, principals: []string{probeKRN("principal-wildcard", "user/*")}}},
+		},
+		{
+			Name:        "wildcard-deny",
+			Description: "denied by a tenant wildcard Deny statement overriding an exact Allow one",
+			Decision:    ExplicitDeny,
+			statements: []probeStatement{
+				{typ: model.Allow},
+				{typ: model.Deny, resources: []string{"krn:" + ProbeService + ":wildcard-deny:*"}},
+			},
+		},
+		{
+			Name:        "pool",
+			Description: "allowed only via a pool wildcard resource for a resource in a pool",
+			Resource:    "krn:" + ProbeService + ":pool:/pool-1:endpoint/probe",
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{"krn:" + ProbeService + ":pool:/*"}}},
+		},
+		{
+			Name:        "path",
+			Description: "allowed only via a resource ID wildcard resource below a resource path",
+			Resource:    probeKRN("path", "endpoint/path-1/path-2/probe"),
+			Decision:    Allow,
+			statements:  []probeStatement{{typ: model.Allow, resources: []string{probeKRN("path", "endpoint/path-1/path-2/*")}}},
+		},
+	}
+
+	for i := range res {
+		p := &res[i]
+
+		if p.Action == "" {
+			p.Action = probeAction
+		}
+
+		if p.Principal == "" {
+			p.Principal = probeKRN(p.Name, "user/probe")
+		}
+
+		if p.Resource == "" {
+			p.Resource = probeKRN(p.Name, "endpoint/probe")
+		}
+
+		for j := range p.statements {
+			s := &p.statements[j]
+
+			if s.actions == nil {
+				s.actions = []string{probeAction}
+			}
+
+			if s.resources == nil {
+				s.resources = []string{p.Resource}
+			}
+
+			if s.principals == nil {
+				s.principals = []string{p.Principal}
+			}
+		}
+
+		// The statements of implicitly denied probes do not match by design
+		if p.Decision != ImplicitDeny {
+			p.Statements = len(p.statements)
+		}
+	}
+
+	return res
+}
+
+// Tuple parses the evaluated tuple of the probe.
+func (p *Probe) Tuple() (EvaluationTuple, error) {
+	principal, err := krn.NewKRNFromString(p.Principal)
+	if err != nil {
+		return EvaluationTuple{}, fmt.Errorf("probe %s: %w", p.Name, err)
+	}
+
+	resource, err := krn.NewKRNFromString(p.Resource)
+	if err != nil {
+		return EvaluationTuple{}, fmt.Errorf("probe %s: %w", p.Name, err)
+	}
+
+	return EvaluationTuple{Principal: principal, Action: action.Action(p.Action), Resource: resource}, nil
+}
+
+// probeKRN returns the KRN of the probe tenant with the given resource type, path and ID, e.g. "endpoint/probe".
+func probeKRN(probe, resource string) string {
+	return "krn:" + ProbeService + ":" + probe + "::" + resource
+}
+
+// PlantProbes creates the statements of the probes.
+func PlantProbes(ctx context.Context, store StatementStore, probes []Probe) error {
+	statements, err := probeStatements(probes)
+	if err != nil {
+		return err
+	}
+
+	return store.Create(ctx, statements)
+}
+
+func probeStatements(probes []Probe) ([]*model.Statement, error) {
+	var res []*model.Statement
+
+	for i := range probes {
+		for _, s := range probes[i].statements {
+			statement, err := s.build()
+			if err != nil {
+				return nil, fmt.Errorf("probe %s: %w", probes[i].Name, err)
+			}
+
+			res = append(res, statement)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *probeStatement) build() (*model.Statement, error) {
+	resources, err := parseProbeKRNs(s.resources)
+	if err != nil {
+		return nil, err
+	}
+
+	principals, err := parseProbeKRNs(s.principals)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]action.Action, len(s.actions))
+	for i := range s.actions {
+		actions[i] = action.Action(s.actions[i])
+	}
+
+	return &model.Statement{Type: s.typ, Actions: actions, Resources: resources, Principals: principals}, nil
+}
+
+func parseProbeKRNs(krns []string) ([]*krn.KRN, error) {
+	res := make([]*krn.KRN, len(krns))
+
+	for i, k := range krns {
+		parsed, err := krn.NewKRNFromString(k)
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = parsed
+	}
+
+	return res, nil
+}
+
+// WriteProbeManifest writes the manifest as indented JSON, creating missing directories.
+func WriteProbeManifest(path string, manifest *ProbeManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadProbeManifest reads a JSON probe manifest.
+func ReadProbeManifest(path string) (*ProbeManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m ProbeManifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return &m, nil
+}
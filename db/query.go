@@ -0,0 +1,223 @@
+package db
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+)
+
+// Query is a parameterized SQL statement built from an EvaluatePermissionRequest.
+// Args are positionally bound to the $1..$N placeholders in SQL.
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+// BuildSearchStatementIdsQuery builds the query selecting ids of statements matching the request.
+func BuildSearchStatementIdsQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.StatementIdsQuery(request)
+}
+
+// BuildExistSearchStatementQuery builds the query checking whether any statement matches the request.
+func BuildExistSearchStatementQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.ExistQuery(request)
+}
+
+// BuildSearchStatementsQuery builds the query selecting statements matching the request.
+func BuildSearchStatementsQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.StatementsQuery(request)
+}
+
+// BuildSearchStatementTypesQuery builds the query selecting distinct types of statements matching the request.
+func BuildSearchStatementTypesQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.StatementTypesQuery(request)
+}
+
+// BuildBatchSearchStatementTypesQuery builds a single query selecting distinct (request index, statement type) pairs
+// for statements matching each of the requests, which must have non-empty Actions, Resources and Principals.
+// Request types are ignored.
+func BuildBatchSearchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query {
+	return statementsQueries.BatchStatementTypesQuery(requests)
+}
+
+// BuildSearchResourcesQuery builds the query selecting distinct resources of statements matching the request.
+func BuildSearchResourcesQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.ResourcesQuery(request)
+}
+
+// BuildSearchResourcesGroupingByTypeQuery builds the query aggregating resources of statements matching the request
+// by statement type.
+func BuildSearchResourcesGroupingByTypeQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.ResourcesGroupingByTypeQuery(request)
+}
+
+// BuildSearchPrincipalsQuery builds the query selecting distinct principals of statements matching the request.
+func BuildSearchPrincipalsQuery(request *EvaluatePermissionRequest) Query {
+	return statementsQueries.PrincipalsQuery(request)
+}
+
+// arrayQueries builds the queries of the array schema against its statements table.
+type arrayQueries struct {
+	table string
+}
+
+// statementsQueries builds the queries against the statements table.
+var statementsQueries = arrayQueries{table: "statements"}
+
+func (q arrayQueries) StatementIdsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.id from " + q.table + " s where 1 = 1 ").
+		where(request).
+		build()
+}
+
+func (q arrayQueries) ExistQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select exists(select s.id from " + q.table + " s where 1 = 1 ").
+		where(request).
+		append(")").
+		build()
+}
+
+func (q arrayQueries) StatementsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.id, s.actions, s.resources, s.principals, s.type from " + q.table + " s where 1 = 1 ").
+		where(request).
+		append(newline + "order by s.id").
+		build()
+}
+
+func (q arrayQueries) StatementTypesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct s.type from " + q.table + " s where 1 = 1 ").
+		where(request).
+		build()
+}
+
+func (q arrayQueries) BatchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query {
+	b := newQueryBuilder("select t.idx, s.type from (values ")
+
+	for i, request := range requests {
+		if i > 0 {
+			b.append(", ")
+		}
+
+		b.append("(" + b.bind(i) + "::int, " +
+			b.bind(textArray(request.Actions)) + "::text[], " +
+			b.bind(textArray(request.Resources)) + "::text[], " +
+			b.bind(textArray(request.Principals)) + "::text[])")
+	}
+
+	return b.append(") as t(idx, actions, resources, principals)" +
+		newline + "join " + q.table + ` s on s."actions" && t.actions AND s."resources" && t.resources AND s."principals" && t.principals` +
+		newline + "group by t.idx, s.type").
+		build()
+}
+
+func (q arrayQueries) ResourcesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct unnest(s.resources) from " + q.table + " s where 1 = 1 ").
+		where(request).
+		build()
+}
+
+func (q arrayQueries) ResourcesGroupingByTypeQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.type, r as krn from " + q.table + " s CROSS JOIN LATERAL unnest(s.resources) r where 1 = 1 ").
+		where(request).
+		append(newline + "group by s.type, r;").
+		build()
+}
+
+func (q arrayQueries) PrincipalsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct unnest(s.principals) from " + q.table + " s where 1 = 1 ").
+		where(request).
+		build()
+}
+
+type queryBuilder struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+func newQueryBuilder(query string) *queryBuilder {
+	b := &queryBuilder{}
+	b.sql.WriteString(query)
+
+	return b
+}
+
+// where appends a filter for every non-empty request field.
+// Array fields are bound as a single text[] parameter each and compared with the && (overlap) operator.
+func (b *queryBuilder) where(request *EvaluatePermissionRequest) *queryBuilder {
+	if request.Type != "" {
+		b.append(newline + "AND s.type = " + b.bind(request.Type))
+	}
+
+	b.overlap("actions", request.Actions)
+	b.overlap("resources", request.Resources)
+	b.overlap("principals", request.Principals)
+
+	return b
+}
+
+func (b *queryBuilder) overlap(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+
+	b.append(newline + `AND s."` + column + `" && ` + b.bind(textArray(values)) + "::text[]")
+}
+
+func (b *queryBuilder) append(query string) *queryBuilder {
+	b.sql.WriteString(query)
+
+	return b
+}
+
+// bind registers a query argument and returns its placeholder.
+func (b *queryBuilder) bind(value interface{}) string {
+	b.args = append(b.args, value)
+
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *queryBuilder) build() Query {
+	return Query{SQL: b.sql.String(), Args: b.args}
+}
+
+// textArray is a string slice bound as a PostgreSQL text[] literal. The slice itself is never modified.
+type textArray []string
+
+// Value implements the driver.Valuer interface.
+func (a textArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	// There will be at least two curly brackets, 2*N bytes of quotes,
+	// and N-1 bytes of delimiters.
+	b := make([]byte, 1, 1+3*len(a))
+	b[0] = '{'
+
+	for i := range a {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = appendArrayQuotedString(b, a[i])
+	}
+
+	return string(append(b, '}')), nil
+}
+
+func appendArrayQuotedString(b []byte, v string) []byte {
+	b = append(b, '"')
+	for {
+		i := strings.IndexAny(v, `"\`)
+		if i < 0 {
+			b = append(b, v...)
+			break
+		}
+		if i > 0 {
+			b = append(b, v[:i]...)
+		}
+		b = append(b, '\\', v[i])
+		v = v[i+1:]
+	}
+	return append(b, '"')
+}
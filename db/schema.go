@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+
+	"gorm.io/gorm"
+)
+
+// Schema is a PostgreSQL storage layout of statements: its tables, its indexes and the queries searching them.
+//
+// Every schema keeps its statements in tables of its own, so several schemas can be seeded from the same generated
+// dataset into one database and benchmarked side by side with the same scenarios. A PostgresStore runs the queries of
+// its schema.
+type Schema interface {
+	QueryBuilder
+
+	// Name is the config.Schema* name of the schema.
+	Name() string
+	// Tables are the tables of the schema, its statements table first. Rows of the other tables belong to statements
+	// and are deleted along with them.
+	Tables() []string
+	// Columns is the select list of whole statements of the statements table aliased s, matching the model.Statement
+	// columns.
+	Columns() string
+
+	// Migrate creates the tables and indexes of the schema if missing.
+	Migrate(ctx context.Context) error
+	// CreateIndexes creates the search indexes of the schema if missing, and DropIndexes drops them.
+	CreateIndexes(ctx context.Context) error
+	DropIndexes(ctx context.Context) error
+	// Insert stores statements and assigns their IDs.
+	Insert(ctx context.Context, statements []*model.Statement) error
+}
+
+// QueryBuilder builds the search queries of a Schema, one per StatementStore search method.
+type QueryBuilder interface {
+	ExistQuery(request *EvaluatePermissionRequest) Query
+	StatementsQuery(request *EvaluatePermissionRequest) Query
+	StatementTypesQuery(request *EvaluatePermissionRequest) Query
+	// BatchStatementTypesQuery selects distinct (request index, statement type) pairs as idx and type columns.
+	BatchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query
+	StatementIdsQuery(request *EvaluatePermissionRequest) Query
+	ResourcesQuery(request *EvaluatePermissionRequest) Query
+	// ResourcesGroupingByTypeQuery selects distinct (statement type, resource) pairs as type and krn columns.
+	ResourcesGroupingByTypeQuery(request *EvaluatePermissionRequest) Query
+	PrincipalsQuery(request *EvaluatePermissionRequest) Query
+}
+
+// copySchema is implemented by schemas keeping every statement in a single row of their statements table, which bulk
+// loads fill with COPY.
+type copySchema interface {
+	// copyColumns are the columns written by a bulk load; IDs come from the table sequence.
+	copyColumns() []string
+	// copyValues returns the copyColumns values of a statement.
+	copyValues(statement *model.Statement) ([]interface{}, error)
+}
+
+// NewSchema constructs the named schema on top of an existing client.
+func NewSchema(client *Client, name string) (Schema, error) {
+	switch name {
+	case config.SchemaArray:
+		return &arraySchema{client: client, arrayQueries: statementsQueries}, nil
+	case config.SchemaJSONB:
+		return &jsonbSchema{client: client}, nil
+	case config.SchemaNormalized:
+		return &normalizedSchema{client: client}, nil
+	case config.SchemaLtree:
+		return &ltreeSchema{client: client}, nil
+	case config.SchemaEffective:
+		return newEffectiveSchema(client), nil
+	}
+
+	return nil, fmt.Errorf("unknown schema %q", name)
+}
+
+// arraySchema keeps statement values in the text[] columns of the statements table, searched with the && operator
+// backed by GIN indexes. It is the original schema of the benchmark.
+type arraySchema struct {
+	client *Client
+	arrayQueries
+}
+
+func (s *arraySchema) Name() string { return config.SchemaArray }
+
+func (s *arraySchema) Tables() []string { return []string{s.table} }
+
+func (s *arraySchema) Columns() string { return "s.id, s.actions, s.resources, s.principals, s.type" }
+
+func (s *arraySchema) Migrate(ctx context.Context) error { return s.withContext(ctx).Migrate() }
+
+func (s *arraySchema) CreateIndexes(ctx context.Context) error {
+	return backendError(s.withContext(ctx).CreateStatementGinIndexes())
+}
+
+func (s *arraySchema) DropIndexes(ctx context.Context) error {
+	return s.client.DropStatementIndexes(ctx)
+}
+
+// Insert inserts statements by createBatchSize rows with IDs allocated by nextIDs, which gorm inserts as they are set.
+func (s *arraySchema) Insert(ctx context.Context, statements []*model.Statement) error {
+	db := s.client.Client.WithContext(ctx)
+
+	for start := 0; start < len(statements); start += createBatchSize {
+		end := start + createBatchSize
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		ids, err := nextIDs(db, s.table, end-start)
+		if err != nil {
+			return backendError(err)
+		}
+
+		batch := statements[start:end]
+		for i, statement := range batch {
+			statement.ID = ids[i]
+		}
+
+		if err = db.Table(s.table).Create(batch).Error; err != nil {
+			// Statements of failed batches stay without IDs, as with the other schemas
+			for _, statement := range batch {
+				statement.ID = 0
+			}
+
+			return backendError(err)
+		}
+	}
+
+	return nil
+}
+
+// withContext returns the client of the schema running its queries with ctx.
+func (s *arraySchema) withContext(ctx context.Context) *Client {
+	return &Client{Client: s.client.Client.WithContext(ctx)}
+}
+
+func (s *arraySchema) copyColumns() []string {
+	return []string{"type", "actions", "resources", "principals"}
+}
+
+// copyValues encodes the arrays as text[] values, which the binary COPY format writes without any quoting.
+func (s *arraySchema) copyValues(statement *model.Statement) ([]interface{}, error) {
+	return []interface{}{statement.Type, actionStrings(statement.Actions), krnStrings(statement.Resources), krnStrings(statement.Principals)}, nil
+}
+
+// nextIDs allocates n IDs from the sequence of the id column of table. Every schema inserts rows with these IDs, so
+// statement IDs never rely on the order of the rows returned by a multi-row insert, which PostgreSQL does not
+// guarantee.
+func nextIDs(db *gorm.DB, table string, n int) ([]uint, error) {
+	b := newQueryBuilder("select nextval(pg_get_serial_sequence(")
+	query := b.append(b.bind(table) + ", 'id')) from generate_series(1, " + b.bind(n) + ")").build()
+
+	var ids []uint
+	if err := rawQuery(db, query).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/config"
+)
+
+// effectiveSchema keeps statements as the array schema does in a table of its own, along with the materialized
+// effective_permissions table holding a row per (principal, action, resource, effect) granted by any statement. Row
+// triggers on the statements table maintain effective_permissions incrementally, so permission checks become primary
+// key lookups at the expense of writing every combination of statement values.
+//
+// Effective permissions only exist for statements with actions, resources and principals, hence only searches
+// filtering on all of them use the table and all the others fall back to the array queries.
+type effectiveSchema struct {
+	*arraySchema
+}
+
+// effectiveMaintain maintains effective_permissions on every statement change: the combinations of the old values are
+// decremented, dropping those left without statements, and the combinations of the new values are incremented. The
+// statements column counts the statements granting a combination, so overlapping statements are kept apart.
+const effectiveMaintain = `CREATE OR REPLACE FUNCTION maintain_effective_permissions() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+	IF TG_OP <> 'INSERT' THEN
+		WITH d AS (
+			select p.v as principal, a.v as action, r.v as resource, count(*) as n
+			from unnest(OLD.principals) p(v), unnest(OLD.actions) a(v), unnest(OLD.resources) r(v)
+			group by 1, 2, 3
+		), removed AS (
+			DELETE FROM effective_permissions e USING d
+			WHERE e.principal = d.principal AND e.action = d.action AND e.resource = d.resource AND e.effect = OLD.type
+				AND e.statements <= d.n
+		)
+		UPDATE effective_permissions e SET statements = e.statements - d.n FROM d
+		WHERE e.principal = d.principal AND e.action = d.action AND e.resource = d.resource AND e.effect = OLD.type
+			AND e.statements > d.n;
+	END IF;
+
+	IF TG_OP <> 'DELETE' THEN
+		INSERT INTO effective_permissions (principal, action, resource, effect, statements)
+		select p.v, a.v, r.v, NEW.type, count(*)
+		from unnest(NEW.principals) p(v), unnest(NEW.actions) a(v), unnest(NEW.resources) r(v)
+		group by 1, 2, 3
+		ON CONFLICT (principal, action, resource, effect)
+		DO UPDATE SET statements = effective_permissions.statements + EXCLUDED.statements;
+	END IF;
+
+	RETURN NULL;
+END
+$$;`
+
+func newEffectiveSchema(client *Client) *effectiveSchema {
+	return &effectiveSchema{&arraySchema{client: client, arrayQueries: arrayQueries{table: "statements_effective"}}}
+}
+
+func (s *effectiveSchema) Name() string { return config.SchemaEffective }
+
+func (s *effectiveSchema) Tables() []string { return []string{s.table, "effective_permissions"} }
+
+// Migrate creates both tables and the maintaining trigger. The trigger fires for every row, COPY included, while
+// TRUNCATE empties both tables at once.
+func (s *effectiveSchema) Migrate(ctx context.Context) error {
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS statements_effective (
+			id bigserial PRIMARY KEY,
+			actions text[],
+			resources text[],
+			principals text[],
+			type varchar(256)
+		);`,
+		`CREATE TABLE IF NOT EXISTS effective_permissions (
+			principal text NOT NULL,
+			action text NOT NULL,
+			resource text NOT NULL,
+			effect varchar(256) NOT NULL,
+			statements int NOT NULL,
+			PRIMARY KEY (principal, action, resource, effect)
+		);`,
+		effectiveMaintain,
+		"DROP TRIGGER IF EXISTS maintain_effective_permissions ON statements_effective;",
+		`CREATE TRIGGER maintain_effective_permissions AFTER INSERT OR DELETE OR UPDATE OF actions, resources, principals, type
+			ON statements_effective FOR EACH ROW EXECUTE FUNCTION maintain_effective_permissions();`,
+	} {
+		if err := s.client.Client.WithContext(ctx).Exec(statement).Error; err != nil {
+			return backendError(err)
+		}
+	}
+
+	return s.CreateIndexes(ctx)
+}
+
+// CreateIndexes creates the search indexes of the statements table. The effective_permissions primary key is never
+// dropped, as the trigger relies on it.
+func (s *effectiveSchema) CreateIndexes(ctx context.Context) error {
+	for _, index := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_gin_statements_effective_actions ON statements_effective USING GIN (actions);",
+		"CREATE INDEX IF NOT EXISTS idx_gin_statements_effective_resources ON statements_effective USING GIN (resources);",
+		"CREATE INDEX IF NOT EXISTS idx_gin_statements_effective_principals ON statements_effective USING GIN (principals);",
+		"CREATE INDEX IF NOT EXISTS idx_hash_statements_effective_type ON statements_effective USING hash (type);",
+	} {
+		if err := s.client.Client.WithContext(ctx).Exec(index).Error; err != nil {
+			return backendError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *effectiveSchema) DropIndexes(ctx context.Context) error {
+	return backendError(s.client.Client.WithContext(ctx).Exec("DROP INDEX IF EXISTS idx_gin_statements_effective_actions, " +
+		"idx_gin_statements_effective_resources, idx_gin_statements_effective_principals, idx_hash_statements_effective_type;").Error)
+}
+
+func (s *effectiveSchema) ExistQuery(request *EvaluatePermissionRequest) Query {
+	if !effectiveRequest(request) {
+		return s.arraySchema.ExistQuery(request)
+	}
+
+	return newQueryBuilder("select exists(select 1 from effective_permissions e where ").
+		effectiveWhere(request).
+		append(")").
+		build()
+}
+
+func (s *effectiveSchema) StatementTypesQuery(request *EvaluatePermissionRequest) Query {
+	if !effectiveRequest(request) {
+		return s.arraySchema.StatementTypesQuery(request)
+	}
+
+	return newQueryBuilder("select distinct e.effect as type from effective_permissions e where ").
+		effectiveWhere(request).
+		build()
+}
+
+// BatchStatementTypesQuery looks up the effective permissions of each request by their primary key.
+func (s *effectiveSchema) BatchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query {
+	b := newQueryBuilder("select t.idx, e.effect as type from (values ")
+
+	for i, request := range requests {
+		if i > 0 {
+			b.append(", ")
+		}
+
+		b.append("(" + b.bind(i) + "::int, " +
+			b.bind(textArray(request.Actions)) + "::text[], " +
+			b.bind(textArray(request.Resources)) + "::text[], " +
+			b.bind(textArray(request.Principals)) + "::text[])")
+	}
+
+	return b.append(") as t(idx, actions, resources, principals)" +
+		newline + "join effective_permissions e on e.principal = any(t.principals) AND e.action = any(t.actions) AND e.resource = any(t.resources)" +
+		newline + "group by t.idx, e.effect").
+		build()
+}
+
+// effectiveRequest reports whether effective permissions answer the request.
+func effectiveRequest(request *EvaluatePermissionRequest) bool {
+	return len(request.Principals) > 0 && len(request.Actions) > 0 && len(request.Resources) > 0
+}
+
+// effectiveWhere appends the conditions on the primary key columns in their order, followed by the type filter.
+func (b *queryBuilder) effectiveWhere(request *EvaluatePermissionRequest) *queryBuilder {
+	b.append("e.principal = any(" + b.bind(textArray(request.Principals)) + "::text[])" +
+		newline + "AND e.action = any(" + b.bind(textArray(request.Actions)) + "::text[])" +
+		newline + "AND e.resource = any(" + b.bind(textArray(request.Resources)) + "::text[])")
+
+	if request.Type != "" {
+		b.append(newline + "AND e.effect = " + b.bind(request.Type))
+	}
+
+	return b
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"strings"
+)
+
+// jsonbSchema keeps statement values in a jsonb document per statement, e.g.
+// {"actions": ["iam:endpoint:read"], "resources": ["krn:..."], "principals": ["krn:..."]}, searched with jsonpath
+// predicates (the @@ operator) backed by a jsonb_path_ops GIN index.
+type jsonbSchema struct {
+	client *Client
+}
+
+// jsonbDocument is the document of a statement.
+type jsonbDocument struct {
+	Actions    []string `json:"actions"`
+	Resources  []string `json:"resources"`
+	Principals []string `json:"principals"`
+}
+
+func (s *jsonbSchema) Name() string { return config.SchemaJSONB }
+
+func (s *jsonbSchema) Tables() []string { return []string{"statements_jsonb"} }
+
+func (s *jsonbSchema) Columns() string {
+	return "s.id, " + jsonbArray("actions") + " as actions, " + jsonbArray("resources") + " as resources, " +
+		jsonbArray("principals") + " as principals, s.type"
+}
+
+func (s *jsonbSchema) Migrate(ctx context.Context) error {
+	err := s.client.Client.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS statements_jsonb (
+		id bigserial PRIMARY KEY,
+		type varchar(256) NOT NULL,
+		document jsonb NOT NULL
+	);`).Error
+	if err != nil {
+		return backendError(err)
+	}
+
+	return s.CreateIndexes(ctx)
+}
+
+func (s *jsonbSchema) CreateIndexes(ctx context.Context) error {
+	for _, index := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_gin_statements_jsonb_document ON statements_jsonb USING GIN (document jsonb_path_ops);",
+		"CREATE INDEX IF NOT EXISTS idx_hash_statements_jsonb_type ON statements_jsonb USING hash (type);",
+	} {
+		if err := s.client.Client.WithContext(ctx).Exec(index).Error; err != nil {
+			return backendError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *jsonbSchema) DropIndexes(ctx context.Context) error {
+	return backendError(s.client.Client.WithContext(ctx).
+		Exec("DROP INDEX IF EXISTS idx_gin_statements_jsonb_document, idx_hash_statements_jsonb_type;").Error)
+}
+
+// Insert inserts statements by createBatchSize rows with IDs allocated by nextIDs.
+func (s *jsonbSchema) Insert(ctx context.Context, statements []*model.Statement) error {
+	db := s.client.Client.WithContext(ctx)
+
+	for start := 0; start < len(statements); start += createBatchSize {
+		end := start + createBatchSize
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		ids, err := nextIDs(db, "statements_jsonb", end-start)
+		if err != nil {
+			return backendError(err)
+		}
+
+		b := newQueryBuilder("insert into statements_jsonb (id, type, document) values ")
+
+		for i, statement := range statements[start:end] {
+			document, err := jsonbStatementDocument(statement)
+			if err != nil {
+				return err
+			}
+
+			if i > 0 {
+				b.append(", ")
+			}
+
+			b.append("(" + b.bind(ids[i]) + ", " + b.bind(statement.Type) + ", " + b.bind(document) + "::jsonb)")
+		}
+
+		query := b.build()
+		if err = db.Exec(query.SQL, query.Args...).Error; err != nil {
+			return backendError(err)
+		}
+
+		for i, statement := range statements[start:end] {
+			statement.ID = ids[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *jsonbSchema) ExistQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select exists(select s.id from statements_jsonb s where 1 = 1 ").
+		jsonbWhere(request).
+		append(")").
+		build()
+}
+
+func (s *jsonbSchema) StatementsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select " + s.Columns() + " from statements_jsonb s where 1 = 1 ").
+		jsonbWhere(request).
+		append(newline + "order by s.id").
+		build()
+}
+
+func (s *jsonbSchema) StatementTypesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct s.type from statements_jsonb s where 1 = 1 ").
+		jsonbWhere(request).
+		build()
+}
+
+// BatchStatementTypesQuery matches every statement document against the jsonpath predicate of each request.
+func (s *jsonbSchema) BatchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query {
+	b := newQueryBuilder("select t.idx, s.type from (values ")
+
+	for i, request := range requests {
+		if i > 0 {
+			b.append(", ")
+		}
+
+		b.append("(" + b.bind(i) + "::int, " + b.bind(jsonbPath(request)) + "::jsonpath)")
+	}
+
+	return b.append(") as t(idx, path)" +
+		newline + "join statements_jsonb s on s.document @@ t.path" +
+		newline + "group by t.idx, s.type").
+		build()
+}
+
+func (s *jsonbSchema) StatementIdsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.id from statements_jsonb s where 1 = 1 ").
+		jsonbWhere(request).
+		build()
+}
+
+func (s *jsonbSchema) ResourcesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct jsonb_array_elements_text(s.document->'resources') from statements_jsonb s where 1 = 1 ").
+		jsonbWhere(request).
+		build()
+}
+
+func (s *jsonbSchema) ResourcesGroupingByTypeQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.type, r as krn from statements_jsonb s CROSS JOIN LATERAL jsonb_array_elements_text(s.document->'resources') r where 1 = 1 ").
+		jsonbWhere(request).
+		append(newline + "group by s.type, r;").
+		build()
+}
+
+func (s *jsonbSchema) PrincipalsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct jsonb_array_elements_text(s.document->'principals') from statements_jsonb s where 1 = 1 ").
+		jsonbWhere(request).
+		build()
+}
+
+func (s *jsonbSchema) copyColumns() []string { return []string{"type", "document"} }
+
+func (s *jsonbSchema) copyValues(statement *model.Statement) ([]interface{}, error) {
+	document, err := jsonbStatementDocument(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{statement.Type, document}, nil
+}
+
+// jsonbWhere appends the type filter and a single jsonpath predicate for all non-empty request arrays, which the
+// jsonb_path_ops GIN index answers at once.
+func (b *queryBuilder) jsonbWhere(request *EvaluatePermissionRequest) *queryBuilder {
+	if request.Type != "" {
+		b.append(newline + "AND s.type = " + b.bind(request.Type))
+	}
+
+	if path := jsonbPath(request); path != "" {
+		b.append(newline + "AND s.document @@ " + b.bind(path) + "::jsonpath")
+	}
+
+	return b
+}
+
+// jsonbPath returns the jsonpath predicate of a document sharing a value with every non-empty request array, e.g.
+// `($.actions[*] == "iam:endpoint:read") && ($.resources[*] == "krn:a:*" || $.resources[*] == "krn:a:b:*")`, or an
+// empty string for no arrays.
+func jsonbPath(request *EvaluatePermissionRequest) string {
+	var conditions []string
+
+	for _, field := range []struct {
+		key    string
+		values []string
+	}{
+		{"actions", request.Actions},
+		{"resources", request.Resources},
+		{"principals", request.Principals},
+	} {
+		if len(field.values) == 0 {
+			continue
+		}
+
+		alternatives := make([]string, len(field.values))
+		for i, value := range field.values {
+			// JSON string escapes are valid jsonpath string escapes
+			quoted, _ := json.Marshal(value)
+			alternatives[i] = "$." + field.key + "[*] == " + string(quoted)
+		}
+
+		conditions = append(conditions, "("+strings.Join(alternatives, " || ")+")")
+	}
+
+	return strings.Join(conditions, " && ")
+}
+
+// jsonbArray returns the expression converting a document array to a text[] value.
+func jsonbArray(key string) string {
+	return "array(select jsonb_array_elements_text(s.document->'" + key + "'))"
+}
+
+func jsonbStatementDocument(statement *model.Statement) (string, error) {
+	document := jsonbDocument{
+		Actions:    actionStrings(statement.Actions),
+		Resources:  krnStrings(statement.Resources),
+		Principals: krnStrings(statement.Principals),
+	}
+
+	data, err := json.Marshal(document)
+
+	return string(data), err
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"iam-performance-test/service/krn"
+	"strings"
+)
+
+// ltreeSchema keeps statement resources and principals as ltree[] columns of KRN paths, see krn.KRN.Ltree, searched
+// with the ancestor operator @> backed by GiST indexes. Requests are matched by their most specific KRNs only instead
+// of the MatchingKRNs expansion, which the ancestor operator makes redundant. Actions stay text[] columns as in the
+// array schema.
+type ltreeSchema struct {
+	client *Client
+}
+
+// ltreeDecode decodes a KRN path in SQL like krn.NewKRNFromLtree: the escape sequences of every label are replaced left
+// to right, and paths ending with a separator are wildcards. ltreeDecodeArray decodes every path of an array.
+const ltreeDecode = `CREATE OR REPLACE FUNCTION krn_from_ltree(path ltree) RETURNS text LANGUAGE sql IMMUTABLE STRICT AS $$
+	select case when d = '' then '*' when right(d, 1) in (':', '/') then d || '*' else d end
+	from (select coalesce(string_agg(case t.m[1]
+			when '__' then '_' when '_h' then '-' when '_a' then '@' when '_d' then '.' when '_p' then '+'
+			when '_c' then ':' when '_s' then '/' else t.m[1] end, '' order by t.n), '') as d
+		from regexp_matches(path::text, '_.|[^._]', 'g') with ordinality as t(m, n)) as decoded
+$$;`
+
+const ltreeDecodeArray = `CREATE OR REPLACE FUNCTION krn_from_ltree(paths ltree[]) RETURNS text[] LANGUAGE sql IMMUTABLE STRICT AS $$
+	select array(select krn_from_ltree(t.path) from unnest(paths) with ordinality as t(path, n) order by t.n)
+$$;`
+
+func (s *ltreeSchema) Name() string { return config.SchemaLtree }
+
+func (s *ltreeSchema) Tables() []string { return []string{"statements_ltree"} }
+
+func (s *ltreeSchema) Columns() string {
+	return "s.id, s.actions, krn_from_ltree(s.resources) as resources, krn_from_ltree(s.principals) as principals, s.type"
+}
+
+func (s *ltreeSchema) Migrate(ctx context.Context) error {
+	for _, statement := range []string{
+		"CREATE EXTENSION IF NOT EXISTS ltree;",
+		ltreeDecode,
+		ltreeDecodeArray,
+		`CREATE TABLE IF NOT EXISTS statements_ltree (
+			id bigserial PRIMARY KEY,
+			type varchar(256) NOT NULL,
+			actions text[] NOT NULL,
+			resources ltree[] NOT NULL,
+			principals ltree[] NOT NULL
+		);`,
+	} {
+		if err := s.client.Client.WithContext(ctx).Exec(statement).Error; err != nil {
+			return backendError(err)
+		}
+	}
+
+	return s.CreateIndexes(ctx)
+}
+
+func (s *ltreeSchema) CreateIndexes(ctx context.Context) error {
+	for _, index := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_gin_statements_ltree_actions ON statements_ltree USING GIN (actions);",
+		"CREATE INDEX IF NOT EXISTS idx_gist_statements_ltree_resources ON statements_ltree USING GIST (resources);",
+		"CREATE INDEX IF NOT EXISTS idx_gist_statements_ltree_principals ON statements_ltree USING GIST (principals);",
+		"CREATE INDEX IF NOT EXISTS idx_hash_statements_ltree_type ON statements_ltree USING hash (type);",
+	} {
+		if err := s.client.Client.WithContext(ctx).Exec(index).Error; err != nil {
+			return backendError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ltreeSchema) DropIndexes(ctx context.Context) error {
+	return backendError(s.client.Client.WithContext(ctx).Exec("DROP INDEX IF EXISTS idx_gin_statements_ltree_actions, " +
+		"idx_gist_statements_ltree_resources, idx_gist_statements_ltree_principals, idx_hash_statements_ltree_type;").Error)
+}
+
+// Insert inserts statements by createBatchSize rows with IDs allocated by nextIDs. KRN paths are bound as text[]
+// literals of ltree values.
+func (s *ltreeSchema) Insert(ctx context.Context, statements []*model.Statement) error {
+	db := s.client.Client.WithContext(ctx)
+
+	for start := 0; start < len(statements); start += createBatchSize {
+		end := start + createBatchSize
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		ids, err := nextIDs(db, "statements_ltree", end-start)
+		if err != nil {
+			return backendError(err)
+		}
+
+		b := newQueryBuilder("insert into statements_ltree (id, type, actions, resources, principals) values ")
+
+		for i, statement := range statements[start:end] {
+			if i > 0 {
+				b.append(", ")
+			}
+
+			b.append("(" + b.bind(ids[i]) + ", " + b.bind(statement.Type) + ", " +
+				b.bind(textArray(actionStrings(statement.Actions))) + "::text[], " +
+				b.bind(textArray(ltreePaths(statement.Resources))) + "::ltree[], " +
+				b.bind(textArray(ltreePaths(statement.Principals))) + "::ltree[])")
+		}
+
+		query := b.build()
+		if err = db.Exec(query.SQL, query.Args...).Error; err != nil {
+			return backendError(err)
+		}
+
+		for i, statement := range statements[start:end] {
+			statement.ID = ids[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *ltreeSchema) ExistQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select exists(select s.id from statements_ltree s where 1 = 1 ").
+		ltreeWhere(request).
+		append(")").
+		build()
+}
+
+func (s *ltreeSchema) StatementsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select " + s.Columns() + " from statements_ltree s where 1 = 1 ").
+		ltreeWhere(request).
+		append(newline + "order by s.id").
+		build()
+}
+
+func (s *ltreeSchema) StatementTypesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct s.type from statements_ltree s where 1 = 1 ").
+		ltreeWhere(request).
+		build()
+}
+
+// BatchStatementTypesQuery joins every statement with the most specific resource paths of each request, which lets
+// every join use the resources index, and filters the principals with an ancestor of any request principal path.
+func (s *ltreeSchema) BatchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query {
+	b := newQueryBuilder("select t.idx, s.type from (values ")
+
+	for i, request := range requests {
+		if i > 0 {
+			b.append(", ")
+		}
+
+		b.append("(" + b.bind(i) + "::int, " +
+			b.bind(textArray(request.Actions)) + "::text[], " +
+			b.bind(textArray(ltreeLeaves(request.Resources))) + "::ltree[], " +
+			b.bind(textArray(ltreeLeaves(request.Principals))) + "::ltree[])")
+	}
+
+	return b.append(") as t(idx, actions, resources, principals)" +
+		newline + "CROSS JOIN LATERAL unnest(t.resources) r" +
+		newline + "join statements_ltree s on s.resources @> r AND s.actions && t.actions AND s.principals @> any(t.principals)" +
+		newline + "group by t.idx, s.type").
+		build()
+}
+
+func (s *ltreeSchema) StatementIdsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.id from statements_ltree s where 1 = 1 ").
+		ltreeWhere(request).
+		build()
+}
+
+func (s *ltreeSchema) ResourcesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct krn_from_ltree(r) from statements_ltree s CROSS JOIN LATERAL unnest(s.resources) r where 1 = 1 ").
+		ltreeWhere(request).
+		build()
+}
+
+func (s *ltreeSchema) ResourcesGroupingByTypeQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.type, krn_from_ltree(r) as krn from statements_ltree s CROSS JOIN LATERAL unnest(s.resources) r where 1 = 1 ").
+		ltreeWhere(request).
+		append(newline + "group by s.type, r;").
+		build()
+}
+
+func (s *ltreeSchema) PrincipalsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct krn_from_ltree(p) from statements_ltree s CROSS JOIN LATERAL unnest(s.principals) p where 1 = 1 ").
+		ltreeWhere(request).
+		build()
+}
+
+// ltreeWhere appends the type filter, the actions overlap and, for non-empty request KRNs, a statement KRN being an
+// ancestor of any of their most specific paths.
+func (b *queryBuilder) ltreeWhere(request *EvaluatePermissionRequest) *queryBuilder {
+	if request.Type != "" {
+		b.append(newline + "AND s.type = " + b.bind(request.Type))
+	}
+
+	b.overlap("actions", request.Actions)
+	b.ancestor("resources", request.Resources)
+	b.ancestor("principals", request.Principals)
+
+	return b
+}
+
+// ancestor appends a condition per path ORed together, as GiST indexes do not support ancestors of any array
+// element.
+func (b *queryBuilder) ancestor(column string, krns []string) {
+	if len(krns) == 0 {
+		return
+	}
+
+	paths := ltreeLeaves(krns)
+	if len(paths) == 0 {
+		// None of the KRNs is valid, so none matches
+		b.append(newline + "AND false")
+		return
+	}
+
+	conditions := make([]string, len(paths))
+	for i, path := range paths {
+		conditions[i] = "s." + column + " @> " + b.bind(path) + "::ltree"
+	}
+
+	b.append(newline + "AND (" + strings.Join(conditions, " OR ") + ")")
+}
+
+// ltreeLeaves returns the sorted distinct paths of the valid KRNs which are not an ancestor of another one, e.g. only
+// the KRN itself for its MatchingKRNs.
+func ltreeLeaves(krns []string) []string {
+	paths := make(stringSet, len(krns))
+
+	for _, s := range krns {
+		if k, err := krn.NewKRNFromString(s); err == nil {
+			paths.add(k.Ltree())
+		}
+	}
+
+	sorted := paths.slice()
+	res := sorted[:0]
+
+	// An ancestor sorts right before its first descendant
+	for i, path := range sorted {
+		if i == len(sorted)-1 || !ltreeAncestor(path, sorted[i+1]) {
+			res = append(res, path)
+		}
+	}
+
+	return res
+}
+
+// ltreeAncestor reports whether the ancestor path is a proper ancestor of path.
+func ltreeAncestor(ancestor, path string) bool {
+	return (ancestor == "" && path != "") || strings.HasPrefix(path, ancestor+".")
+}
+
+func ltreePaths(krns []*krn.KRN) []string {
+	res := make([]string, len(krns))
+	for i := range krns {
+		res[i] = krns[i].Ltree()
+	}
+
+	return res
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// normalizedSchema keeps every action, resource and principal of a statement in a row of its own child table, searched
+// with EXISTS subqueries backed by B-tree indexes on the values instead of array overlaps.
+type normalizedSchema struct {
+	client *Client
+}
+
+// normalizedValues are the child tables of the normalized schema along with their value columns and the statement
+// values they hold.
+var normalizedValues = []struct {
+	table, column string
+	values        func(statement *model.Statement) []string
+}{
+	{"statement_actions", "action", func(statement *model.Statement) []string { return actionStrings(statement.Actions) }},
+	{"statement_resources", "krn", func(statement *model.Statement) []string { return krnStrings(statement.Resources) }},
+	{"statement_principals", "krn", func(statement *model.Statement) []string { return krnStrings(statement.Principals) }},
+}
+
+func (s *normalizedSchema) Name() string { return config.SchemaNormalized }
+
+func (s *normalizedSchema) Tables() []string {
+	return []string{"statements_normalized", "statement_actions", "statement_resources", "statement_principals"}
+}
+
+// Columns aggregates the child rows of every statement in their original order.
+func (s *normalizedSchema) Columns() string {
+	return "s.id, " + normalizedArray("statement_actions", "action") + " as actions, " +
+		normalizedArray("statement_resources", "krn") + " as resources, " +
+		normalizedArray("statement_principals", "krn") + " as principals, s.type"
+}
+
+// Migrate creates the statements table and the child tables. Child rows reference their statement, so deleting a
+// statement cascades to its values, and are keyed by statement and position, which keeps the original value order.
+func (s *normalizedSchema) Migrate(ctx context.Context) error {
+	err := s.client.Client.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS statements_normalized (
+		id bigserial PRIMARY KEY,
+		type varchar(256) NOT NULL
+	);`).Error
+	if err != nil {
+		return backendError(err)
+	}
+
+	for _, values := range normalizedValues {
+		err = s.client.Client.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS ` + values.table + ` (
+			statement_id bigint NOT NULL REFERENCES statements_normalized (id) ON DELETE CASCADE,
+			position int NOT NULL,
+			` + values.column + ` text NOT NULL,
+			PRIMARY KEY (statement_id, position)
+		);`).Error
+		if err != nil {
+			return backendError(err)
+		}
+	}
+
+	return s.CreateIndexes(ctx)
+}
+
+// CreateIndexes creates a B-tree index per child table on the value followed by the statement ID, which answers the
+// EXISTS subqueries with index-only scans.
+func (s *normalizedSchema) CreateIndexes(ctx context.Context) error {
+	for _, values := range normalizedValues {
+		err := s.client.Client.WithContext(ctx).Exec("CREATE INDEX IF NOT EXISTS " + normalizedIndex(values.table) + " ON " +
+			values.table + " (" + values.column + ", statement_id);").Error
+		if err != nil {
+			return backendError(err)
+		}
+	}
+
+	err := s.client.Client.WithContext(ctx).
+		Exec("CREATE INDEX IF NOT EXISTS idx_hash_statements_normalized_type ON statements_normalized USING hash (type);").Error
+
+	return backendError(err)
+}
+
+func (s *normalizedSchema) DropIndexes(ctx context.Context) error {
+	indexes := "idx_hash_statements_normalized_type"
+	for _, values := range normalizedValues {
+		indexes += ", " + normalizedIndex(values.table)
+	}
+
+	return backendError(s.client.Client.WithContext(ctx).Exec("DROP INDEX IF EXISTS " + indexes + ";").Error)
+}
+
+// Insert inserts statements by createBatchSize rows with IDs allocated by nextIDs, and then their values with a single
+// unnest insert per child table. Every batch is a transaction of its own, so a failed insert leaves no statements
+// without their values.
+func (s *normalizedSchema) Insert(ctx context.Context, statements []*model.Statement) error {
+	for start := 0; start < len(statements); start += createBatchSize {
+		end := start + createBatchSize
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		err := s.client.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return s.insertBatch(tx, statements[start:end])
+		})
+		if err != nil {
+			return backendError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *normalizedSchema) insertBatch(tx *gorm.DB, statements []*model.Statement) error {
+	ids, err := nextIDs(tx, "statements_normalized", len(statements))
+	if err != nil {
+		return err
+	}
+
+	b := newQueryBuilder("insert into statements_normalized (id, type) values ")
+
+	for i, statement := range statements {
+		if i > 0 {
+			b.append(", ")
+		}
+
+		b.append("(" + b.bind(ids[i]) + ", " + b.bind(statement.Type) + ")")
+	}
+
+	query := b.build()
+	if err = tx.Exec(query.SQL, query.Args...).Error; err != nil {
+		return err
+	}
+
+	for i, statement := range statements {
+		statement.ID = ids[i]
+	}
+
+	for _, values := range normalizedValues {
+		var statementIds, positions, column []string
+
+		for _, statement := range statements {
+			row := values.values(statement)
+
+			for j := range row {
+				statementIds = append(statementIds, strconv.FormatUint(uint64(statement.ID), 10))
+				positions = append(positions, strconv.Itoa(j))
+			}
+
+			column = append(column, row...)
+		}
+
+		// The arrays are bound as text[] literals and cast, which keeps the number of parameters constant
+		b := newQueryBuilder("insert into " + values.table + " (statement_id, position, " + values.column + ") select * from unnest(")
+		query = b.append(b.bind(textArray(statementIds)) + "::text[]::bigint[], " + b.bind(textArray(positions)) + "::text[]::int[], " +
+			b.bind(textArray(column)) + "::text[])").build()
+
+		if err := tx.Exec(query.SQL, query.Args...).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *normalizedSchema) ExistQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select exists(select s.id from statements_normalized s where 1 = 1 ").
+		normalizedWhere(request).
+		append(")").
+		build()
+}
+
+func (s *normalizedSchema) StatementsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select " + s.Columns() + " from statements_normalized s where 1 = 1 ").
+		normalizedWhere(request).
+		append(newline + "order by s.id").
+		build()
+}
+
+func (s *normalizedSchema) StatementTypesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct s.type from statements_normalized s where 1 = 1 ").
+		normalizedWhere(request).
+		build()
+}
+
+// BatchStatementTypesQuery matches every statement against the value arrays of each request with EXISTS subqueries.
+func (s *normalizedSchema) BatchStatementTypesQuery(requests []*EvaluatePermissionRequest) Query {
+	b := newQueryBuilder("select t.idx, s.type from (values ")
+
+	for i, request := range requests {
+		if i > 0 {
+			b.append(", ")
+		}
+
+		b.append("(" + b.bind(i) + "::int, " +
+			b.bind(textArray(request.Actions)) + "::text[], " +
+			b.bind(textArray(request.Resources)) + "::text[], " +
+			b.bind(textArray(request.Principals)) + "::text[])")
+	}
+
+	return b.append(") as t(idx, actions, resources, principals)" +
+		newline + "join statements_normalized s on " + normalizedExists("statement_actions", "action", "t.actions") +
+		newline + "AND " + normalizedExists("statement_resources", "krn", "t.resources") +
+		newline + "AND " + normalizedExists("statement_principals", "krn", "t.principals") +
+		newline + "group by t.idx, s.type").
+		build()
+}
+
+func (s *normalizedSchema) StatementIdsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.id from statements_normalized s where 1 = 1 ").
+		normalizedWhere(request).
+		build()
+}
+
+func (s *normalizedSchema) ResourcesQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct r.krn from statements_normalized s join statement_resources r on r.statement_id = s.id where 1 = 1 ").
+		normalizedWhere(request).
+		build()
+}
+
+func (s *normalizedSchema) ResourcesGroupingByTypeQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select s.type, r.krn from statements_normalized s join statement_resources r on r.statement_id = s.id where 1 = 1 ").
+		normalizedWhere(request).
+		append(newline + "group by s.type, r.krn;").
+		build()
+}
+
+func (s *normalizedSchema) PrincipalsQuery(request *EvaluatePermissionRequest) Query {
+	return newQueryBuilder("select distinct p.krn from statements_normalized s join statement_principals p on p.statement_id = s.id where 1 = 1 ").
+		normalizedWhere(request).
+		build()
+}
+
+// normalizedWhere appends the type filter and an EXISTS subquery for every non-empty request array, each bound as a
+// single text[] parameter.
+func (b *queryBuilder) normalizedWhere(request *EvaluatePermissionRequest) *queryBuilder {
+	if request.Type != "" {
+		b.append(newline + "AND s.type = " + b.bind(request.Type))
+	}
+
+	for _, field := range []struct {
+		table, column string
+		values        []string
+	}{
+		{"statement_actions", "action", request.Actions},
+		{"statement_resources", "krn", request.Resources},
+		{"statement_principals", "krn", request.Principals},
+	} {
+		if len(field.values) > 0 {
+			b.append(newline + "AND " + normalizedExists(field.table, field.column, b.bind(textArray(field.values))+"::text[]"))
+		}
+	}
+
+	return b
+}
+
+// normalizedExists returns the condition of statement s having a value of the child table among the array.
+func normalizedExists(table, column, array string) string {
+	return "EXISTS (select 1 from " + table + " v where v." + column + " = any(" + array + ") AND v.statement_id = s.id)"
+}
+
+// normalizedArray returns the expression aggregating the values of statement s in the child table to a text[] value.
+func normalizedArray(table, column string) string {
+	return "array(select v." + column + " from " + table + " v where v.statement_id = s.id order by v.position)"
+}
+
+func normalizedIndex(table string) string { return "idx_btree_" + table + "_value" }
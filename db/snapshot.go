@@ -0,0 +1,201 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"io"
+	"time"
+)
+
+const (
+	// SnapshotFormat identifies statement snapshots in their header.
+	SnapshotFormat = "iam-performance-test/statements"
+	// SnapshotVersion is the version of the snapshot format written by Export.
+	SnapshotVersion = 1
+)
+
+// exportPageSize is the number of statements read from the store at once during an export.
+const exportPageSize = 1000
+
+// SnapshotHeader is the first line of a statement snapshot.
+type SnapshotHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Dataset holds the generator parameters and seed of the exported statements.
+	Dataset config.Dataset `json:"dataset"`
+	// Statements is the number of statements following the header.
+	Statements int64 `json:"statements"`
+}
+
+// Export writes all statements of the store as a gzip-compressed snapshot of newline-delimited JSON: the header
+// followed by one model.Statement per line in ID order. Importing the snapshot into an empty store recreates the
+// statements in the same order.
+//
+// The store must not change during the export.
+func Export(ctx context.Context, store StatementStore, w io.Writer, dataset config.Dataset) (*SnapshotHeader, error) {
+	counts, err := store.CountByType(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &SnapshotHeader{Format: SnapshotFormat, Version: SnapshotVersion, CreatedAt: time.Now().UTC(), Dataset: dataset}
+	for _, count := range counts {
+		header.Statements += count
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	if err = enc.Encode(header); err != nil {
+		return nil, err
+	}
+
+	var written int64
+	var lastID uint
+
+	for {
+		statements, err := store.ListAfter(ctx, lastID, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range statements {
+			if err = enc.Encode(&statements[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		written += int64(len(statements))
+
+		if len(statements) < exportPageSize {
+			break
+		}
+
+		lastID = statements[len(statements)-1].ID
+	}
+
+	if written != header.Statements {
+		return nil, fmt.Errorf("the store changed during the export: counted %d statements, exported %d", header.Statements, written)
+	}
+
+	return header, gz.Close()
+}
+
+// SnapshotReader reads the statements of a snapshot written by Export.
+type SnapshotReader struct {
+	Header SnapshotHeader
+
+	gz   *gzip.Reader
+	dec  *json.Decoder
+	read int64
+}
+
+// NewSnapshotReader reads and checks the snapshot header. The caller must close the reader.
+func NewSnapshotReader(r io.Reader) (*SnapshotReader, error) {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSnapshot, err)
+	}
+
+	res := &SnapshotReader{gz: gz, dec: json.NewDecoder(gz)}
+
+	if err = res.dec.Decode(&res.Header); err != nil {
+		gz.Close()
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformedSnapshot, err)
+	}
+
+	switch h := &res.Header; {
+	case h.Format != SnapshotFormat:
+		err = fmt.Errorf("%w: unknown format %q", ErrMalformedSnapshot, h.Format)
+	case h.Version < 1 || h.Version > SnapshotVersion:
+		err = fmt.Errorf("%w: unsupported version %d", ErrMalformedSnapshot, h.Version)
+	case h.Statements < 0:
+		err = fmt.Errorf("%w: negative statement count", ErrMalformedSnapshot)
+	}
+
+	if err != nil {
+		gz.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Next returns the next statement without an ID, or nil after the last one. It returns an ErrMalformedSnapshot-wrapping
+// error for invalid statements and for snapshots with fewer or more statements than their header announces.
+func (r *SnapshotReader) Next() (*model.Statement, error) {
+	var statement model.Statement
+
+	err := r.dec.Decode(&statement)
+
+	switch {
+	case errors.Is(err, io.EOF):
+		if r.read != r.Header.Statements {
+			return nil, fmt.Errorf("%w: %d statements of %d", ErrMalformedSnapshot, r.read, r.Header.Statements)
+		}
+
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("%w: statement %d: %v", ErrMalformedSnapshot, r.read+1, err)
+	case r.read == r.Header.Statements:
+		return nil, fmt.Errorf("%w: more statements than %d", ErrMalformedSnapshot, r.Header.Statements)
+	case statement.Type != model.Allow && statement.Type != model.Deny:
+		return nil, fmt.Errorf("%w: statement %d: unknown type %q", ErrMalformedSnapshot, r.read+1, statement.Type)
+	case len(statement.Actions) == 0 || len(statement.Resources) == 0:
+		return nil, fmt.Errorf("%w: statement %d: no actions or resources", ErrMalformedSnapshot, r.read+1)
+	}
+
+	r.read++
+	statement.ID = 0
+
+	return &statement, nil
+}
+
+// Close releases the decompressor. It does not close the underlying reader.
+func (r *SnapshotReader) Close() error { return r.gz.Close() }
+
+// Import creates the statements of the snapshot in batches of batchSize and returns their number. The store should
+// be empty to recreate the exported statements with the same IDs. A failed import keeps the batches created so far.
+func Import(ctx context.Context, store StatementStore, r *SnapshotReader, batchSize int) (int64, error) {
+	var created int64
+
+	statements := make([]*model.Statement, 0, batchSize)
+
+	for {
+		statement, err := r.Next()
+		if err != nil {
+			return created, err
+		}
+
+		if statement != nil {
+			if statements = append(statements, statement); len(statements) < batchSize {
+				continue
+			}
+		}
+
+		if len(statements) > 0 {
+			if err = store.Create(ctx, statements); err != nil {
+				return created, err
+			}
+
+			created += int64(len(statements))
+			statements = statements[:0]
+		}
+
+		if statement == nil {
+			return created, nil
+		}
+	}
+}
+
+// BulkImport copies the statements of the snapshot into the statements table like BulkLoad.
+func (s *PostgresStore) BulkImport(ctx context.Context, r *SnapshotReader, progress func(LoadProgress)) (*LoadStats, error) {
+	return s.copyStatements(ctx, newStatementSource(r.Next, r.Header.Statements, progress))
+}
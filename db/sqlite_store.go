@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statementValue is a single action, resource or principal of a statement.
+// SQLite has no array type, so SQLiteStore mirrors every statement array into this table to search by value.
+type statementValue struct {
+	StatementID uint   `gorm:"column:statement_id;not null;index"`
+	Kind        string `gorm:"column:kind;not null;size:16;index:idx_statement_values_kind_value,priority:1"`
+	Value       string `gorm:"column:value;not null;index:idx_statement_values_kind_value,priority:2"`
+}
+
+const (
+	actionValueKind    = "actions"
+	resourceValueKind  = "resources"
+	principalValueKind = "principals"
+)
+
+// SQLiteStore is a StatementStore keeping statements in a SQLite database.
+type SQLiteStore struct {
+	gormStatements
+}
+
+// NewSQLiteStore opens (creating if necessary) the SQLite database at cfg.SQLitePath and migrates its tables.
+// Use ":memory:" for a throwaway database.
+func NewSQLiteStore(cfg config.Database) (*SQLiteStore, error) {
+	db, err := gorm.Open(sqlite.Open(cfg.SQLitePath), &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel(cfg.LogLevel))})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.AutoMigrate(&model.Statement{}, &statementValue{}); err != nil {
+		return nil, err
+	}
+
+	return &SQLiteStore{gormStatements{db: db}}, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, statements []*model.Statement) error {
+	return backendError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(statements, createBatchSize).Error; err != nil {
+			return err
+		}
+
+		var values []*statementValue
+		for _, statement := range statements {
+			for i := range statement.Actions {
+				values = append(values, &statementValue{StatementID: statement.ID, Kind: actionValueKind, Value: statement.Actions[i].String()})
+			}
+
+			for _, resource := range statement.Resources {
+				values = append(values, &statementValue{StatementID: statement.ID, Kind: resourceValueKind, Value: resource.String()})
+			}
+
+			for _, principal := range statement.Principals {
+				values = append(values, &statementValue{StatementID: statement.ID, Kind: principalValueKind, Value: principal.String()})
+			}
+		}
+
+		return tx.CreateInBatches(values, createBatchSize).Error
+	}))
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id uint) error {
+	return backendError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := (gormStatements{db: tx}).Delete(ctx, id); err != nil {
+			return err
+		}
+
+		return tx.Where("statement_id = ?", id).Delete(&statementValue{}).Error
+	}))
+}
+
+func (s *SQLiteStore) Reset(ctx context.Context) error {
+	return backendError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("delete from statement_values").Error; err != nil {
+			return err
+		}
+
+		return tx.Exec("delete from statements").Error
+	}))
+}
+
+func (s *SQLiteStore) Exists(ctx context.Context, request *EvaluatePermissionRequest) (bool, error) {
+	var isExists bool
+
+	where, args := sqliteWhere(request)
+	err := s.db.WithContext(ctx).Raw("select exists(select s.id from statements s where 1 = 1 "+where+")", args...).Scan(&isExists).Error
+
+	return isExists, backendError(err)
+}
+
+func (s *SQLiteStore) SearchStatements(ctx context.Context, request *EvaluatePermissionRequest) (model.Statements, error) {
+	var statements model.Statements
+
+	where, args := sqliteWhere(request)
+	err := s.db.WithContext(ctx).Raw("select s.* from statements s where 1 = 1 "+where+newline+"order by s.id", args...).Scan(&statements).Error
+
+	return statements, backendError(err)
+}
+
+func (s *SQLiteStore) SearchStatementTypes(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	var types []string
+
+	where, args := sqliteWhere(request)
+	err := s.db.WithContext(ctx).Raw("select distinct s.type from statements s where 1 = 1 "+where, args...).Scan(&types).Error
+
+	return types, backendError(err)
+}
+
+func (s *SQLiteStore) BatchSearchStatementTypes(ctx context.Context, requests []*EvaluatePermissionRequest) ([][]string, error) {
+	return batchSearchStatementTypes(ctx, s, requests)
+}
+
+func (s *SQLiteStore) SearchStatementIds(ctx context.Context, request *EvaluatePermissionRequest) ([]uint64, error) {
+	var statementIds []uint64
+
+	where, args := sqliteWhere(request)
+	err := s.db.WithContext(ctx).Raw("select s.id from statements s where 1 = 1 "+where, args...).Scan(&statementIds).Error
+
+	return statementIds, backendError(err)
+}
+
+func (s *SQLiteStore) SearchResources(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	return s.searchValues(ctx, resourceValueKind, request)
+}
+
+func (s *SQLiteStore) SearchResourcesGroupingByType(ctx context.Context, request *EvaluatePermissionRequest) ([]string, []string, error) {
+	krnToType := make([]map[string]interface{}, 0)
+
+	where, args := sqliteWhere(request)
+	query := "select s.type, v.value as krn from statements s join statement_values v on v.statement_id = s.id and v.kind = '" + resourceValueKind + "' where 1 = 1 " +
+		where + newline + "group by s.type, v.value;"
+
+	if err := s.db.WithContext(ctx).Raw(query, args...).Scan(&krnToType).Error; err != nil {
+		return nil, nil, backendError(err)
+	}
+
+	allowed, denied := splitByType(krnToType)
+
+	return allowed, denied, nil
+}
+
+func (s *SQLiteStore) SearchPrincipals(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error) {
+	return s.searchValues(ctx, principalValueKind, request)
+}
+
+func (s *SQLiteStore) Close() error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+func (s *SQLiteStore) searchValues(ctx context.Context, kind string, request *EvaluatePermissionRequest) ([]string, error) {
+	var values []string
+
+	where, args := sqliteWhere(request)
+	query := "select distinct v.value from statement_values v where v.kind = '" + kind + "' and v.statement_id in (select s.id from statements s where 1 = 1 " +
+		where + ")"
+	err := s.db.WithContext(ctx).Raw(query, args...).Scan(&values).Error
+
+	return values, backendError(err)
+}
+
+// sqliteWhere is the SQLite counterpart of queryBuilder.where: array overlaps become EXISTS lookups into statement_values.
+func sqliteWhere(request *EvaluatePermissionRequest) (string, []interface{}) {
+	var (
+		where string
+		args  []interface{}
+	)
+
+	if request.Type != "" {
+		where += newline + "AND s.type = ?"
+		args = append(args, request.Type)
+	}
+
+	for _, filter := range []struct {
+		kind   string
+		values []string
+	}{
+		{actionValueKind, request.Actions},
+		{resourceValueKind, request.Resources},
+		{principalValueKind, request.Principals},
+	} {
+		if len(filter.values) == 0 {
+			continue
+		}
+
+		where += newline + "AND exists(select 1 from statement_values v where v.statement_id = s.id and v.kind = ? and v.value in ?)"
+		args = append(args, filter.kind, filter.values)
+	}
+
+	return where, args
+}
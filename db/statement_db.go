@@ -1,25 +1,16 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"iam-performance-test/config"
 	"iam-performance-test/model"
 	"iam-performance-test/service/action"
 	"iam-performance-test/service/krn"
-	"math/rand"
-	"strconv"
-	"strings"
-	"time"
-
-	"github.com/google/uuid"
 )
 
 const (
-	ResourceCount  = 10
-	PrincipalCount = 5
-	ServiceCount   = 100
-	StatementCount = 10_000
-	BatchSize      = 500
-	newline        = `
+	newline = `
 	`
 )
 
@@ -30,133 +21,67 @@ type EvaluatePermissionRequest struct {
 	Type       string
 }
 
-func SearchStatementIdsByParams(statementIds *[]uint64, request *EvaluatePermissionRequest) {
-
-	start := time.Now()
-	query := "select s.id from statements s where 1 = 1 "
-
-	if request.Type != "" {
-		query += newline + "AND type = ?"
-	}
-
-	if len(request.Actions) != 0 {
-		query += whereClause(request.Actions, "actions")
+// Validate returns an ErrMalformedRequest-wrapping error if the request has an invalid action, KRN or type.
+func (r *EvaluatePermissionRequest) Validate() error {
+	if r == nil {
+		return fmt.Errorf("%w: nil request", ErrMalformedRequest)
 	}
 
-	if len(request.Resources) != 0 {
-		query += whereClause(request.Resources, "resources")
+	switch r.Type {
+	case "", model.Allow, model.Deny:
+	default:
+		return fmt.Errorf("%w: unknown statement type %q", ErrMalformedRequest, r.Type)
 	}
 
-	if len(request.Principals) != 0 {
-		query += whereClause(request.Principals, "principals")
+	for _, a := range r.Actions {
+		if !action.Action(a).IsValid() {
+			return fmt.Errorf("%w: invalid action %q", ErrMalformedRequest, a)
+		}
 	}
 
-	client, err := NewClient()
-
-	if err != nil {
-		fmt.Printf("Error occurred during connecting to PostgresSQL: %v", err)
+	for _, krns := range [][]string{r.Resources, r.Principals} {
+		for _, k := range krns {
+			if _, err := krn.NewKRNFromString(k); err != nil {
+				return fmt.Errorf("%w: %v", ErrMalformedRequest, err)
+			}
+		}
 	}
 
-	client.Client.Raw(query, request.Type).Scan(statementIds)
-	fmt.Printf("Search took: %s; Result length: %s\n", time.Since(start).String(), strconv.Itoa(len(*statementIds)))
+	return nil
 }
 
-func ExistSearchStatementByParams(request *EvaluatePermissionRequest) bool {
-	var isExists bool
-
-	start := time.Now()
-	query := "select exists(select s.id from statements s where 1 = 1 "
-
-	if len(request.Actions) != 0 {
-		query += whereClause(request.Actions, "actions")
-	}
-
-	if len(request.Resources) != 0 {
-		query += whereClause(request.Resources, "resources")
-	}
-
-	if len(request.Principals) != 0 {
-		query += whereClause(request.Principals, "principals")
+func SearchStatementIdsByParams(ctx context.Context, store StatementStore, request *EvaluatePermissionRequest) ([]uint64, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
 	}
 
-	query += ")"
-
-	client, err := NewClient()
-
-	if err != nil {
-		fmt.Printf("Error occurred during connecting to PostgresSQL: %v", err)
-	}
-
-	client.Client.Raw(query).Scan(&isExists)
-
-	fmt.Printf("Search took: %s; Result:  %s\n", time.Since(start).String(), strconv.FormatBool(isExists))
-	return isExists
+	return store.SearchStatementIds(ctx, request)
 }
 
-func SearchResourcesByParams(request *EvaluatePermissionRequest) *[]string {
-	var resources []string
-
-	start := time.Now()
-	query := "select distinct unnest(s.resources) from statements s where 1 = 1 "
-
-	if len(request.Actions) != 0 {
-		query += whereClause(request.Actions, "actions")
-	}
-
-	if len(request.Resources) != 0 {
-		query += whereClause(request.Resources, "resources")
-	}
-
-	if len(request.Principals) != 0 {
-		query += whereClause(request.Principals, "principals")
+// ExistSearchStatementByParams returns whether any statement matches the request.
+// A non-nil error means no decision was made, and the caller must fail closed.
+func ExistSearchStatementByParams(ctx context.Context, store StatementStore, request *EvaluatePermissionRequest) (bool, error) {
+	if err := request.Validate(); err != nil {
+		return false, err
 	}
 
-	client, err := NewClient()
-
-	if err != nil {
-		fmt.Printf("Error occurred during connecting to PostgresSQL: %v", err)
-	}
-
-	client.Client.Raw(query).Scan(&resources)
-
-	fmt.Printf("Search took: %s; Result length:  %s\n", time.Since(start).String(), strconv.Itoa(len(resources)))
-	return &resources
+	return store.Exists(ctx, request)
 }
 
-func SearchResourcesByParamsGroupingByType(request *EvaluatePermissionRequest) ([]string, []string, error) {
-	krnToType := make([]map[string]interface{}, 0)
-
-	start := time.Now()
-	query := "select s.type, array_agg(distinct r) as krn from statements s CROSS JOIN LATERAL unnest(s.resources) r where 1 = 1 "
-
-	if len(request.Actions) != 0 {
-		query += whereClause(request.Actions, "actions")
-	}
-
-	if len(request.Resources) != 0 {
-		query += whereClause(request.Resources, "resources")
-	}
-
-	if len(request.Principals) != 0 {
-		query += whereClause(request.Principals, "principals")
+func SearchResourcesByParams(ctx context.Context, store StatementStore, request *EvaluatePermissionRequest) ([]string, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
 	}
 
-	query += newline + "group by s.type;"
-
-	client, err := NewClient()
+	return store.SearchResources(ctx, request)
+}
 
-	if err != nil {
-		fmt.Printf("Error occurred during connecting to PostgresSQL: %v", err)
+func SearchResourcesByParamsGroupingByType(ctx context.Context, store StatementStore, request *EvaluatePermissionRequest) ([]string, []string, error) {
+	if err := request.Validate(); err != nil {
 		return nil, nil, err
 	}
 
-	client.Client.Raw(query).Scan(&krnToType)
-
-	fmt.Printf("Search took: %s \n", time.Since(start).String())
-
-	allowed, denied := splitByType(krnToType)
-
-	return allowed, denied, nil
+	return store.SearchResourcesGroupingByType(ctx, request)
 }
 
 func splitByType(krnToType []map[string]interface{}) ([]string, []string) {
@@ -167,7 +92,7 @@ func splitByType(krnToType []map[string]interface{}) ([]string, []string) {
 		resourceKRN := krnToEffectItem["krn"].(string)
 		resourceEffect := krnToEffectItem["type"]
 
-		if resourceEffect == "Allow" {
+		if resourceEffect == model.Allow {
 			allowed = append(allowed, resourceKRN)
 		} else {
 			denied = append(denied, resourceKRN)
@@ -177,130 +102,44 @@ func splitByType(krnToType []map[string]interface{}) ([]string, []string) {
 	return allowed, denied
 }
 
-func SearchPrincipalsByParams(request *EvaluatePermissionRequest) *[]string {
-	var resources []string
-
-	start := time.Now()
-	query := "select distinct unnest(s.principals) from statements s where 1 = 1 "
-
-	if len(request.Actions) != 0 {
-		query += whereClause(request.Actions, "actions")
-	}
-
-	if len(request.Resources) != 0 {
-		query += whereClause(request.Resources, "resources")
-	}
-
-	if len(request.Principals) != 0 {
-		query += whereClause(request.Principals, "principals")
-	}
-
-	client, err := NewClient()
-
-	if err != nil {
-		fmt.Printf("Error occurred during connecting to PostgresSQL: %v", err)
+func SearchPrincipalsByParams(ctx context.Context, store StatementStore, request *EvaluatePermissionRequest) ([]string, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
 	}
 
-	client.Client.Raw(query).Scan(&resources)
-
-	fmt.Printf("Search took: %s; Result length:  %s\n", time.Since(start).String(), strconv.Itoa(len(resources)))
-	return &resources
-}
-
-func whereClause(values []string, column string) string {
-	where := newline
-
-	where += fmt.Sprintf(`AND "%s" && ARRAY[%v]`, column, prepareArray(values))
-
-	return where
+	return store.SearchPrincipals(ctx, request)
 }
 
-func prepareArray(values []string) string {
-	for i, value := range values {
-		values[i] = `'` + value + `'`
+// FillStatement plants the Probes and generates the dataset into the store. Filling equal datasets, including the
+// seed, into empty stores creates identical statements.
+func FillStatement(ctx context.Context, store StatementStore, dataset config.Dataset) error {
+	if err := PlantProbes(ctx, store, Probes()); err != nil {
+		return fmt.Errorf("planting probes: %w", err)
 	}
 
-	return strings.Join(values, ",")
-}
+	g := NewGenerator(dataset)
 
-func FillStatement() {
-	client, _ := NewClient()
+	for i := 0; i < dataset.ServiceCount; i++ {
+		statements := make([]*model.Statement, 0, dataset.BatchSize)
 
-	for i := 0; i < ServiceCount; i++ {
-		var statements []*model.Statement
-		serviceName := generateRandomString()
+		for j := 0; j < dataset.StatementCount; j++ {
+			statements = append(statements, g.Next())
 
-		for j := 0; j < StatementCount; j++ {
-			if j%10 == 0 {
-				statements = append(statements, buildStatement(serviceName, generateRandomString(), true))
-			} else {
-				statements = append(statements, buildStatement(serviceName, generateRandomString(), false))
+			if len(statements) < dataset.BatchSize && j < dataset.StatementCount-1 {
+				continue
 			}
-		}
 
-		client.Client.CreateInBatches(statements, BatchSize)
-		fmt.Printf("%d of %d statements created\n", (i+1)*StatementCount, ServiceCount*StatementCount)
-	}
-
-	println("Statement filled")
-}
-
-func FillStatementOneAllowedResource(actionParam, resourceParam, principalParam string) {
-	client, _ := NewClient()
-
-	actionsArr := []action.Action{action.Action(actionParam)}
-
-	resourceKrn, _ := krn.NewKRNFromString(resourceParam)
-	resourcesArr := []*krn.KRN{resourceKrn}
-
-	principalKrn, _ := krn.NewKRNFromString(principalParam)
-	principalsArr := []*krn.KRN{principalKrn}
-
-	client.Client.Create(&model.Statement{Type: "Allow", Actions: actionsArr, Resources: resourcesArr, Principals: principalsArr})
-}
-
-func buildStatement(serviceName string, tenantName string, includeServiceWildcard bool) *model.Statement {
-	var actions = []action.Action{"iam:endpoint:read", "iam:endpoint:write", "iam:endpoint:delete"}
+			if err := store.Create(ctx, statements); err != nil {
+				return err
+			}
 
-	var resources []*krn.KRN
-	for i := 0; i < ResourceCount; i++ {
-		var resourceKrn *krn.KRN
-		if i == 0 && includeServiceWildcard {
-			resourceKrn, _ = krn.NewKRNFromString("krn:" + serviceName + ":*")
-		} else if i == 1 {
-			resourceKrn, _ = krn.NewKRNFromString("krn:" + serviceName + ":" + tenantName + "::*")
-		} else {
-			resourceKrn, _ = krn.NewKRNFromString("krn:" + serviceName + ":" + tenantName + "::endpoint/" + uuid.New().String())
+			statements = statements[:0]
 		}
-		resources = append(resources, resourceKrn)
-	}
 
-	var principals []*krn.KRN
-	for i := 0; i < PrincipalCount; i++ {
-		var principalKrn *krn.KRN
-		if i == 0 && includeServiceWildcard {
-			principalKrn, _ = krn.NewKRNFromString("krn:" + serviceName + ":*")
-		} else if i == 1 {
-			principalKrn, _ = krn.NewKRNFromString("krn:" + serviceName + ":" + tenantName + "::*")
-		} else {
-			principalKrn, _ = krn.NewKRNFromString("krn:" + serviceName + ":" + tenantName + "::user/" + uuid.New().String())
-		}
-		principals = append(principals, principalKrn)
+		fmt.Printf("%d of %d statements created\n", (i+1)*dataset.StatementCount, dataset.ServiceCount*dataset.StatementCount)
 	}
 
-	//types := []string{"Allow", "Deny"}
-	//randomIdx := rand.Intn(len(types))
-
-	return &model.Statement{Type: /*types[randomIdx]*/ "Allow", Actions: actions, Resources: resources, Principals: principals}
-}
-
-func generateRandomString() string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyz")
-
-	s := make([]rune, 10)
-	for i := range s {
-		s[i] = letters[rand.Intn(len(letters))]
-	}
+	println("Statement filled")
 
-	return string(s)
+	return nil
 }
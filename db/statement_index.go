@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"sync"
+)
+
+// StatementIndex is an in-process index of statements evaluating permissions without a database round trip.
+// Resources and principals are indexed by krn.Index tries, actions are matched on the candidate statements.
+//
+// StatementIndex is safe for concurrent use.
+type StatementIndex struct {
+	mu         sync.RWMutex
+	statements map[uint]*model.Statement
+	resources  *krn.Index
+	principals *krn.Index
+}
+
+// NewStatementIndex constructs an empty StatementIndex.
+func NewStatementIndex() *StatementIndex {
+	return &StatementIndex{
+		statements: make(map[uint]*model.Statement),
+		resources:  krn.NewIndex(),
+		principals: krn.NewIndex(),
+	}
+}
+
+// LoadStatementIndex builds a StatementIndex from all statements of the source, reading batchSize statements at once
+// with StatementStore.ListAfter.
+func LoadStatementIndex(ctx context.Context, source StatementStore, batchSize int) (*StatementIndex, error) {
+	x := NewStatementIndex()
+
+	var lastID uint
+
+	for {
+		statements, err := source.ListAfter(ctx, lastID, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range statements {
+			x.Add(&statements[i])
+		}
+
+		if len(statements) < batchSize {
+			return x, nil
+		}
+
+		lastID = statements[len(statements)-1].ID
+	}
+}
+
+// Add indexes the statement, replacing an already indexed statement with the same ID.
+func (x *StatementIndex) Add(statement *model.Statement) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.removeLocked(statement.ID)
+
+	x.statements[statement.ID] = statement
+
+	for _, resource := range statement.Resources {
+		x.resources.Insert(resource, statement.ID)
+	}
+
+	for _, principal := range statement.Principals {
+		x.principals.Insert(principal, statement.ID)
+	}
+}
+
+// Remove removes the statement with the given ID from the index and returns whether it was indexed.
+func (x *StatementIndex) Remove(id uint) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.removeLocked(id)
+}
+
+// removeLocked is Remove with x.mu held for writing.
+func (x *StatementIndex) removeLocked(id uint) bool {
+	statement, ok := x.statements[id]
+	if !ok {
+		return false
+	}
+
+	delete(x.statements, id)
+
+	for _, resource := range statement.Resources {
+		x.resources.Remove(resource, id)
+	}
+
+	for _, principal := range statement.Principals {
+		x.principals.Remove(principal, id)
+	}
+
+	return true
+}
+
+// Len returns the number of indexed statements.
+func (x *StatementIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return len(x.statements)
+}
+
+// Match returns statements that apply to principal performing act on resource, ordered by ID.
+func (x *StatementIndex) Match(principal *krn.KRN, act action.Action, resource *krn.KRN) (model.Statements, error) {
+	if _, err := newEvaluationRequest(principal, act, resource); err != nil {
+		return nil, err
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	principalIds := make(map[uint]void)
+	x.principals.MatchFunc(principal, func(id uint) { principalIds[id] = void{} })
+
+	var statements model.Statements
+
+	for _, id := range x.resources.Match(resource) {
+		if _, ok := principalIds[id]; !ok {
+			continue
+		}
+
+		statement := x.statements[id]
+
+		for i := range statement.Actions {
+			if act.Matches(statement.Actions[i]) {
+				statements = append(statements, *statement)
+				break
+			}
+		}
+	}
+
+	return statements, nil
+}
+
+// Evaluate is the in-process counterpart of the package-level Evaluate with identical semantics.
+func (x *StatementIndex) Evaluate(principal *krn.KRN, act action.Action, resource *krn.KRN) (Decision, error) {
+	statements, err := x.Match(principal, act, resource)
+	if err != nil {
+		return ImplicitDeny, err
+	}
+
+	types := make([]string, len(statements))
+	for i := range statements {
+		types[i] = statements[i].Type
+	}
+
+	return decide(types), nil
+}
+
+// String returns a short summary of the index size.
+func (x *StatementIndex) String() string {
+	return fmt.Sprintf("%d statements, %d resource and %d principal patterns", x.Len(), x.resources.Len(), x.principals.Len())
+}
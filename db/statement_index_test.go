@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// The benchmarks evaluate every probe against the in-process index and against the stores, all seeded with the same
+// dataset. By default it has 1k statements and the postgres benchmark is skipped. Comparing the index with the GIN
+// queries at 1M statements, the default with a disposable database set, and IAM_PERF_BENCH_STATEMENTS sets any other
+// size:
+//
+//	IAM_PERF_BENCH_DSN="host=localhost user=iam-perf password=root dbname=iam-perf port=5432 sslmode=disable" \
+//		go test ./db -run '^$' -bench 'StatementIndexEvaluate|StoreEvaluate/postgres' -benchtime 100x -timeout 1h
+//
+// The index takes about 1 GB of memory per 100k statements of the default dataset shape, so that size needs a machine
+// with more than 10 GB. The memory and sqlite stores scan every statement per evaluation, so they are best left out.
+const (
+	// benchPostgresDSN names the environment variable of a disposable PostgreSQL database benchmarking the GIN queries
+	// of the array schema. Its statements are reset before the benchmark and left seeded afterwards.
+	benchPostgresDSN = "IAM_PERF_BENCH_DSN"
+	// benchStatements names the environment variable of the number of statements seeded besides the probes, which
+	// defaults to 1M when benchPostgresDSN is set and to 1k otherwise.
+	benchStatements = "IAM_PERF_BENCH_STATEMENTS"
+)
+
+// benchDataset is the dataset seeded into the benchmarked stores along with the probes. Its services have 1k
+// statements each, so counts above 1k are rounded down to thousands.
+func benchDataset(b *testing.B) config.Dataset {
+	b.Helper()
+
+	count := 1_000
+	if os.Getenv(benchPostgresDSN) != "" {
+		count = 1_000_000
+	}
+
+	if value, ok := os.LookupEnv(benchStatements); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			b.Fatalf("%s: invalid statement count %q", benchStatements, value)
+		}
+
+		count = n
+	}
+
+	dataset := config.Default().Dataset
+	dataset.ServiceCount = 1
+	dataset.StatementCount = count
+
+	if count > 1_000 {
+		dataset.ServiceCount = count / 1_000
+		dataset.StatementCount = 1_000
+	}
+
+	return dataset
+}
+
+var (
+	// benchStores are the filled stores by name. Filling dominates the runs of a benchmark with a growing b.N, so every
+	// store is filled once per test binary.
+	benchStores   = make(map[string]StatementStore)
+	benchStoresMu sync.Mutex
+)
+
+// benchStore returns the named store opened by open and filled with the probes and the benchDataset statements.
+// PostgreSQL stores of schemas supporting COPY are bulk loaded.
+func benchStore(b *testing.B, name string, open func() (StatementStore, error)) StatementStore {
+	b.Helper()
+
+	benchStoresMu.Lock()
+	defer benchStoresMu.Unlock()
+
+	if store, ok := benchStores[name]; ok {
+		return store
+	}
+
+	store, err := open()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if postgres, ok := store.(*PostgresStore); ok && postgres.CanCopy() {
+		if _, err = postgres.BulkLoad(context.Background(), benchDataset(b), nil); err != nil {
+			b.Fatal(err)
+		}
+	} else {
+		benchFill(b, store)
+	}
+
+	benchStores[name] = store
+
+	return store
+}
+
+// benchFill plants the probes and creates the benchDataset statements like FillStatement, only quietly.
+func benchFill(b *testing.B, store StatementStore) {
+	b.Helper()
+
+	ctx := context.Background()
+
+	if err := PlantProbes(ctx, store, Probes()); err != nil {
+		b.Fatal(err)
+	}
+
+	dataset := benchDataset(b)
+	g := NewGenerator(dataset)
+
+	for statement := g.Next(); statement != nil; {
+		batch := make([]*model.Statement, 0, dataset.BatchSize)
+		for ; statement != nil && len(batch) < dataset.BatchSize; statement = g.Next() {
+			batch = append(batch, statement)
+		}
+
+		if err := store.Create(ctx, batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkProbes runs a sub-benchmark per probe evaluating its tuple, failing on decisions other than the probe
+// expects.
+func benchmarkProbes(b *testing.B, evaluate func(tuple EvaluationTuple) (Decision, error)) {
+	for _, probe := range Probes() {
+		probe := probe
+
+		tuple, err := probe.Tuple()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(probe.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				decision, err := evaluate(tuple)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if decision != probe.Decision {
+					b.Fatalf("decision %s, want %s", decision, probe.Decision)
+				}
+			}
+		})
+	}
+}
+
+// TestStatementIndexConcurrentAdd replaces a statement concurrently with copies of different resources, of which only
+// those of the last added copy may stay indexed.
+func TestStatementIndexConcurrentAdd(t *testing.T) {
+	const copies = 16
+
+	x := NewStatementIndex()
+
+	statements := make([]*model.Statement, copies)
+	for i := range statements {
+		statements[i] = testStatement(t, model.Allow, []string{"iam:endpoint:read"},
+			[]string{"krn:svc:t1::endpoint/" + strconv.Itoa(i)}, []string{"krn:svc:t1::user/u1"})
+		statements[i].ID = 1
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range statements {
+		wg.Add(1)
+
+		go func(statement *model.Statement) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				stored := *statement
+				x.Add(&stored)
+			}
+		}(statements[i])
+	}
+
+	wg.Wait()
+
+	matching := 0
+
+	for _, statement := range statements {
+		matched, err := x.Match(statement.Principals[0], statement.Actions[0], statement.Resources[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matching += len(matched)
+	}
+
+	if matching != 1 || x.Len() != 1 {
+		t.Errorf("%d resources of %d indexed statements match, want 1 of 1", matching, x.Len())
+	}
+}
+
+// benchIndex is the index of the probes and the benchDataset statements, once built.
+var benchIndex *StatementIndex
+
+// BenchmarkStatementIndexEvaluate indexes the statements as they are generated, numbered like a store would, rather
+// than loading them from a store, which would keep them in memory twice.
+func BenchmarkStatementIndexEvaluate(b *testing.B) {
+	if benchIndex == nil {
+		statements, err := probeStatements(Probes())
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		index := NewStatementIndex()
+		add := func(statement *model.Statement) {
+			statement.ID = uint(index.Len() + 1)
+			index.Add(statement)
+		}
+
+		for _, statement := range statements {
+			add(statement)
+		}
+
+		g := NewGenerator(benchDataset(b))
+		for statement := g.Next(); statement != nil; statement = g.Next() {
+			add(statement)
+		}
+
+		benchIndex = index
+	}
+
+	index := benchIndex
+	b.Logf("%s", index)
+
+	benchmarkProbes(b, func(tuple EvaluationTuple) (Decision, error) {
+		return index.Evaluate(tuple.Principal, tuple.Action, tuple.Resource)
+	})
+}
+
+// BenchmarkStoreEvaluate evaluates the probes of BenchmarkStatementIndexEvaluate against the stores. The postgres
+// benchmark runs the GIN queries of the array schema and is skipped unless benchPostgresDSN is set.
+func BenchmarkStoreEvaluate(b *testing.B) {
+	b.Run("memory", func(b *testing.B) {
+		benchmarkStoreEvaluate(b, benchStore(b, "memory", func() (StatementStore, error) { return NewMemoryStore(), nil }))
+	})
+
+	b.Run("sqlite", func(b *testing.B) {
+		benchmarkStoreEvaluate(b, benchStore(b, "sqlite", func() (StatementStore, error) {
+			cfg := config.Default().Database
+			cfg.SQLitePath = ":memory:"
+			cfg.LogLevel = config.LogLevelSilent
+
+			return NewSQLiteStore(cfg)
+		}))
+	})
+
+	b.Run("postgres", func(b *testing.B) {
+		dsn := os.Getenv(benchPostgresDSN)
+		if dsn == "" {
+			b.Skipf("%s is not set", benchPostgresDSN)
+		}
+
+		benchmarkStoreEvaluate(b, benchStore(b, "postgres", func() (StatementStore, error) {
+			cfg := config.Default().Database
+			cfg.DSN = dsn
+			cfg.LogLevel = config.LogLevelSilent
+
+			client, err := NewClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			store := NewPostgresStore(client)
+
+			if err = store.Schema().Migrate(context.Background()); err != nil {
+				return nil, fmt.Errorf("migrating: %w", err)
+			}
+
+			return store, store.Reset(context.Background())
+		}))
+	})
+}
+
+func benchmarkStoreEvaluate(b *testing.B, store StatementStore) {
+	ctx := context.Background()
+
+	benchmarkProbes(b, func(tuple EvaluationTuple) (Decision, error) {
+		return Evaluate(ctx, store, tuple.Principal, tuple.Action, tuple.Resource)
+	})
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"iam-performance-test/model"
+
+	"gorm.io/gorm"
+)
+
+// createBatchSize is the maximum number of rows inserted by a single statement.
+const createBatchSize = 500
+
+// StatementStore is a storage backend for IAM statements.
+//
+// Search requests follow the same semantics in every implementation: a statement matches when each non-empty request
+// array shares at least one value with the corresponding statement array (the PostgreSQL && operator),
+// and its type equals the request type if one is given.
+//
+// Storage failures, including context cancellation, are returned as *BackendError.
+type StatementStore interface {
+	// Create stores statements and assigns their IDs.
+	Create(ctx context.Context, statements []*model.Statement) error
+	// Get returns a statement by its ID or ErrNoMatchingStatement.
+	Get(ctx context.Context, id uint) (*model.Statement, error)
+	// List returns at most limit statements ordered by ID, skipping the first offset ones.
+	List(ctx context.Context, offset, limit int) (model.Statements, error)
+	// ListAfter returns at most limit statements with IDs greater than afterID ordered by ID. Unlike List, it does not
+	// slow down deep into the table.
+	ListAfter(ctx context.Context, afterID uint, limit int) (model.Statements, error)
+	// Delete removes a statement by its ID or returns ErrNoMatchingStatement.
+	Delete(ctx context.Context, id uint) error
+
+	// Exists returns whether any statement matches the request.
+	Exists(ctx context.Context, request *EvaluatePermissionRequest) (bool, error)
+	// SearchStatements returns statements matching the request ordered by ID.
+	SearchStatements(ctx context.Context, request *EvaluatePermissionRequest) (model.Statements, error)
+	// SearchStatementTypes returns distinct types of statements matching the request.
+	SearchStatementTypes(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error)
+	// BatchSearchStatementTypes is SearchStatementTypes for many requests at once, which must have non-empty Actions,
+	// Resources and Principals. Results are in the order of requests.
+	BatchSearchStatementTypes(ctx context.Context, requests []*EvaluatePermissionRequest) ([][]string, error)
+	// SearchStatementIds returns IDs of statements matching the request.
+	SearchStatementIds(ctx context.Context, request *EvaluatePermissionRequest) ([]uint64, error)
+	// SearchResources returns distinct resources of statements matching the request.
+	SearchResources(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error)
+	// SearchResourcesGroupingByType returns distinct resources of matching statements split into allowed and denied.
+	SearchResourcesGroupingByType(ctx context.Context, request *EvaluatePermissionRequest) ([]string, []string, error)
+	// SearchPrincipals returns distinct principals of statements matching the request.
+	SearchPrincipals(ctx context.Context, request *EvaluatePermissionRequest) ([]string, error)
+
+	// CountByType returns the number of stored statements per statement type.
+	CountByType(ctx context.Context) (map[string]int64, error)
+	// Reset removes all statements.
+	Reset(ctx context.Context) error
+
+	// Close releases resources held by the store.
+	Close() error
+}
+
+// gormStatements implements the CRUD part of StatementStore shared by gorm-backed stores.
+type gormStatements struct {
+	db *gorm.DB
+}
+
+func (s gormStatements) Get(ctx context.Context, id uint) (*model.Statement, error) {
+	var statement model.Statement
+
+	if err := s.db.WithContext(ctx).First(&statement, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoMatchingStatement
+		}
+
+		return nil, backendError(err)
+	}
+
+	return &statement, nil
+}
+
+func (s gormStatements) List(ctx context.Context, offset, limit int) (model.Statements, error) {
+	var statements model.Statements
+
+	if err := s.db.WithContext(ctx).Order("id").Offset(offset).Limit(limit).Find(&statements).Error; err != nil {
+		return nil, backendError(err)
+	}
+
+	return statements, nil
+}
+
+func (s gormStatements) ListAfter(ctx context.Context, afterID uint, limit int) (model.Statements, error) {
+	var statements model.Statements
+
+	if err := s.db.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&statements).Error; err != nil {
+		return nil, backendError(err)
+	}
+
+	return statements, nil
+}
+
+func (s gormStatements) Delete(ctx context.Context, id uint) error {
+	res := s.db.WithContext(ctx).Delete(&model.Statement{}, id)
+
+	switch {
+	case res.Error != nil:
+		return backendError(res.Error)
+	case res.RowsAffected == 0:
+		return ErrNoMatchingStatement
+	}
+
+	return nil
+}
+
+func (s gormStatements) CountByType(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Type  string
+		Count int64
+	}
+
+	if err := s.db.WithContext(ctx).Model(&model.Statement{}).Select("type, count(*) as count").Group("type").Scan(&rows).Error; err != nil {
+		return nil, backendError(err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+
+	return counts, nil
+}
+
+// batchSearchStatementTypes implements StatementStore.BatchSearchStatementTypes by searching each request in turn.
+func batchSearchStatementTypes(ctx context.Context, store StatementStore, requests []*EvaluatePermissionRequest) ([][]string, error) {
+	res := make([][]string, len(requests))
+
+	for i, request := range requests {
+		types, err := store.SearchStatementTypes(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = types
+	}
+
+	return res, nil
+}
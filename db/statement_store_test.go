@@ -0,0 +1,362 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iam-performance-test/config"
+	"iam-performance-test/model"
+	"iam-performance-test/service/action"
+	"iam-performance-test/service/krn"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type namedStore struct {
+	name  string
+	store StatementStore
+}
+
+// testStores returns an empty store of every backend needing no database server.
+func testStores(t *testing.T) []namedStore {
+	t.Helper()
+
+	cfg := config.Default().Database
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "statements.db")
+	cfg.LogLevel = config.LogLevelSilent
+
+	sqlite, err := NewSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { sqlite.Close() })
+
+	return []namedStore{{"memory", NewMemoryStore()}, {"sqlite", sqlite}}
+}
+
+func testStatement(t *testing.T, typ string, actions, resources, principals []string) *model.Statement {
+	t.Helper()
+
+	statement := &model.Statement{Type: typ, Resources: testKRNs(t, resources), Principals: testKRNs(t, principals)}
+
+	for _, a := range actions {
+		statement.Actions = append(statement.Actions, action.Action(a))
+	}
+
+	return statement
+}
+
+func testKRNs(t *testing.T, krns []string) []*krn.KRN {
+	t.Helper()
+
+	res := make([]*krn.KRN, len(krns))
+
+	for i, s := range krns {
+		k, err := krn.NewKRNFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res[i] = k
+	}
+
+	return res
+}
+
+func TestStoreOverlap(t *testing.T) {
+	ctx := context.Background()
+
+	for _, s := range testStores(t) {
+		t.Run(s.name, func(t *testing.T) {
+			allow := testStatement(t, model.Allow, []string{"iam:endpoint:read", "iam:endpoint:write"},
+				[]string{"krn:svc:t1::endpoint/a", "krn:svc:t1::endpoint/b"}, []string{"krn:svc:t1::user/u1"})
+			deny := testStatement(t, model.Deny, []string{"iam:endpoint:read"},
+				[]string{"krn:svc:t1::endpoint/b"}, []string{"krn:svc:t1::user/u2"})
+
+			if err := s.store.Create(ctx, []*model.Statement{allow, deny}); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range []struct {
+				name    string
+				request EvaluatePermissionRequest
+				want    []*model.Statement
+			}{
+				{"empty request matches all", EvaluatePermissionRequest{}, []*model.Statement{allow, deny}},
+				{"any shared action", EvaluatePermissionRequest{Actions: []string{"iam:endpoint:write", "iam:endpoint:delete"}},
+					[]*model.Statement{allow}},
+				{"any shared resource", EvaluatePermissionRequest{Resources: []string{"krn:svc:t1::endpoint/b", "krn:svc:t1::endpoint/z"}},
+					[]*model.Statement{allow, deny}},
+				{"no shared value", EvaluatePermissionRequest{Resources: []string{"krn:svc:t1::endpoint/z"}}, nil},
+				{"every field overlaps", EvaluatePermissionRequest{Actions: []string{"iam:endpoint:read"},
+					Resources: []string{"krn:svc:t1::endpoint/a"}, Principals: []string{"krn:svc:t1::user/u1"}}, []*model.Statement{allow}},
+				{"one field without overlap", EvaluatePermissionRequest{Actions: []string{"iam:endpoint:write"},
+					Principals: []string{"krn:svc:t1::user/u2"}}, nil},
+				{"type", EvaluatePermissionRequest{Resources: []string{"krn:svc:t1::endpoint/b"}, Type: model.Deny},
+					[]*model.Statement{deny}},
+			} {
+				ids, err := s.store.SearchStatementIds(ctx, &tt.request)
+				if err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+
+				sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+				var want []uint64
+				for _, statement := range tt.want {
+					want = append(want, uint64(statement.ID))
+				}
+
+				if len(ids) != len(want) || (len(ids) > 0 && !reflect.DeepEqual(ids, want)) {
+					t.Errorf("%s: got statements %v, want %v", tt.name, ids, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreNoMatchingStatement(t *testing.T) {
+	ctx := context.Background()
+
+	for _, s := range testStores(t) {
+		t.Run(s.name, func(t *testing.T) {
+			if _, err := s.store.Get(ctx, 42); !errors.Is(err, ErrNoMatchingStatement) {
+				t.Errorf("Get of a missing statement: got %v, want %v", err, ErrNoMatchingStatement)
+			}
+
+			if err := s.store.Delete(ctx, 42); !errors.Is(err, ErrNoMatchingStatement) {
+				t.Errorf("Delete of a missing statement: got %v, want %v", err, ErrNoMatchingStatement)
+			}
+
+			statement := testStatement(t, model.Allow, []string{"iam:endpoint:read"}, []string{"krn:svc:t1::endpoint/a"},
+				[]string{"krn:svc:t1::user/u1"})
+
+			if err := s.store.Create(ctx, []*model.Statement{statement}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.store.Get(ctx, statement.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.ID != statement.ID || got.Type != statement.Type || len(got.Resources) != 1 ||
+				got.Resources[0].String() != "krn:svc:t1::endpoint/a" {
+				t.Errorf("Get: got %+v, want %+v", got, statement)
+			}
+
+			if err = s.store.Delete(ctx, statement.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = s.store.Get(ctx, statement.ID); !errors.Is(err, ErrNoMatchingStatement) {
+				t.Errorf("Get of a deleted statement: got %v, want %v", err, ErrNoMatchingStatement)
+			}
+
+			if err = s.store.Delete(ctx, statement.ID); !errors.Is(err, ErrNoMatchingStatement) {
+				t.Errorf("Delete of a deleted statement: got %v, want %v", err, ErrNoMatchingStatement)
+			}
+		})
+	}
+}
+
+// TestStoreCopiesStatements checks stored statements changing neither with the created statements nor with those
+// returned by the store.
+func TestStoreCopiesStatements(t *testing.T) {
+	ctx := context.Background()
+
+	for _, s := range testStores(t) {
+		t.Run(s.name, func(t *testing.T) {
+			statement := testStatement(t, model.Allow, []string{"iam:endpoint:read"}, []string{"krn:svc:t1::endpoint/a"},
+				[]string{"krn:svc:t1::user/u1"})
+
+			if err := s.store.Create(ctx, []*model.Statement{statement}); err != nil {
+				t.Fatal(err)
+			}
+
+			want := fmt.Sprint(*statement)
+			other := testKRNs(t, []string{"krn:svc:t2::endpoint/b"})[0]
+
+			mutate := func(statement *model.Statement) {
+				statement.Actions[0] = "iam:endpoint:write"
+				*statement.Resources[0] = *other
+				statement.Principals[0] = other
+			}
+
+			mutate(statement)
+
+			got, err := s.store.Get(ctx, statement.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(*got) != want {
+				t.Fatalf("after changing the created statement: got %v, want %v", *got, want)
+			}
+
+			mutate(got)
+
+			listed, err := s.store.List(ctx, 0, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(listed) != 1 || fmt.Sprint(listed[0]) != want {
+				t.Fatalf("after changing a returned statement: got %v, want [%v]", listed, want)
+			}
+
+			mutate(&listed[0])
+
+			if got, err = s.store.Get(ctx, statement.ID); err != nil || fmt.Sprint(*got) != want {
+				t.Errorf("after changing a listed statement: got %v, %v, want %v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestStoreListAfter(t *testing.T) {
+	ctx := context.Background()
+
+	for _, s := range testStores(t) {
+		t.Run(s.name, func(t *testing.T) {
+			statements := make([]*model.Statement, 5)
+			for i := range statements {
+				statements[i] = testStatement(t, model.Allow, []string{"iam:endpoint:read"}, []string{"krn:svc:t1::endpoint/a"},
+					[]string{"krn:svc:t1::user/u1"})
+			}
+
+			if err := s.store.Create(ctx, statements); err != nil {
+				t.Fatal(err)
+			}
+
+			// A deleted statement must not end a page early
+			if err := s.store.Delete(ctx, statements[1].ID); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []uint
+			var pages []int
+			var lastID uint
+
+			for {
+				page, err := s.store.ListAfter(ctx, lastID, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				pages = append(pages, len(page))
+
+				for i := range page {
+					got = append(got, page[i].ID)
+				}
+
+				if len(page) < 2 {
+					break
+				}
+
+				lastID = page[len(page)-1].ID
+			}
+
+			want := []uint{statements[0].ID, statements[2].ID, statements[3].ID, statements[4].ID}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got IDs %v, want %v", got, want)
+			}
+
+			if !reflect.DeepEqual(pages, []int{2, 2, 0}) {
+				t.Errorf("got page sizes %v, want [2 2 0]", pages)
+			}
+		})
+	}
+}
+
+// TestStoreSearchStatementTypesParity checks the stores finding the same statement types for the probes and for
+// requests derived from generated statements.
+func TestStoreSearchStatementTypesParity(t *testing.T) {
+	ctx := context.Background()
+
+	dataset := config.Default().Dataset
+	dataset.ServiceCount = 2
+	dataset.StatementCount = 100
+	dataset.Wildcards = config.Wildcards{Service: 0.2, Tenant: 0.2, ResourceType: 0.2, ResourceID: 0.2}
+	dataset.DenyRatio = 0.3
+
+	var requests []*EvaluatePermissionRequest
+
+	for _, probe := range Probes() {
+		tuple, err := probe.Tuple()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request, err := newEvaluationRequest(tuple.Principal, tuple.Action, tuple.Resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requests = append(requests, request)
+	}
+
+	g := NewGenerator(dataset)
+	for statement := g.Next(); statement != nil; statement = g.Next() {
+		request, err := newEvaluationRequest(statement.Principals[0], statement.Actions[0], statement.Resources[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requests = append(requests, request, &EvaluatePermissionRequest{Resources: []string{statement.Resources[0].String()}})
+	}
+
+	var types [][][]string
+
+	for _, s := range testStores(t) {
+		if err := PlantProbes(ctx, s.store, Probes()); err != nil {
+			t.Fatal(err)
+		}
+
+		g := NewGenerator(dataset)
+
+		var statements []*model.Statement
+		for statement := g.Next(); statement != nil; statement = g.Next() {
+			statements = append(statements, statement)
+		}
+
+		if err := s.store.Create(ctx, statements); err != nil {
+			t.Fatal(err)
+		}
+
+		storeTypes := make([][]string, len(requests))
+
+		for i, request := range requests {
+			found, err := s.store.SearchStatementTypes(ctx, request)
+			if err != nil {
+				t.Fatalf("%s: %v", s.name, err)
+			}
+
+			sort.Strings(found)
+			storeTypes[i] = append([]string{}, found...)
+		}
+
+		types = append(types, storeTypes)
+	}
+
+	denied := 0
+
+	for i, request := range requests {
+		if !reflect.DeepEqual(types[0][i], types[1][i]) {
+			t.Errorf("request %+v: memory found %v, sqlite %v", request, types[0][i], types[1][i])
+		}
+
+		if len(types[0][i]) == 2 {
+			denied++
+		}
+	}
+
+	// Requests matching both types make the parity meaningful
+	if denied == 0 {
+		t.Error("no request matched both Allow and Deny statements")
+	}
+}
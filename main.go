@@ -1,126 +1,111 @@
+// Command iam-performance-test benchmarks IAM statement searches against a statement store.
+//
+// Usage:
+//
+//	iam-performance-test <command> [flags]
+//
+// Run a command with -h to list its flags.
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"iam-performance-test/config"
 	"iam-performance-test/db"
-	"iam-performance-test/service/action"
-	"iam-performance-test/service/krn"
+	"os"
+	"os/signal"
+	"time"
 )
 
 type IAM struct {
 	databaseClient *db.Client
+	store          db.StatementStore
+	// schemaStores are the postgres stores of the configured schemas, sharing databaseClient; store is the first one.
+	schemaStores []*db.PostgresStore
+	queryTimeout time.Duration
+}
+
+// namedStore is a statement store along with its schema, empty for backends other than postgres.
+type namedStore struct {
+	schema string
+	store  db.StatementStore
+}
+
+// stores returns the store of every configured schema of the postgres backend, or the single store of other backends.
+func (s *IAM) stores() []namedStore {
+	if len(s.schemaStores) == 0 {
+		return []namedStore{{store: s.store}}
+	}
+
+	res := make([]namedStore, len(s.schemaStores))
+	for i, store := range s.schemaStores {
+		res[i] = namedStore{schema: store.Schema().Name(), store: store}
+	}
+
+	return res
 }
 
 func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := findCommand(flag.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd.run(ctx, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error occurred during %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun a command with -h to list its flags.\n")
+}
 
-	//s := &IAM{}
-	//
-	//var err error
-	//s.databaseClient, err = db.NewClient()
-	//
-	//if err != nil {
-	//	fmt.Printf("Error occurred during connecting to PostgresSQL: %v", err)
-	//}
-	//
-	//if err = s.databaseClient.Migrate(); err != nil {
-	//	fmt.Errorf("Error on migrating tables: %v", err)
-	//}
-	//
-	//db.FillStatement()
-
-	fmt.Println("CASE-1: Evaluate if user has access to one resource")
-	actions := action.Action("iam:endpoint:read")
-	principalKRN, _ := krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::user/237d750b-a6b3-478c-b81c-aa87dba9fff9")
-	resourceKRN, _ := krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::endpoint/7971a90a-6c70-4784-bc46-55b9b7591627")
-
-	db.ExistSearchStatementByParams(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRN.MatchingKRNs(),
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Println("-----------------------------------------------------------------------------------------------------")
-
-	fmt.Println("CASE-2.1 (wildcard krn): Evaluate if user has access to several resources")
-	actions = action.Action("iam:endpoint:read")
-	principalKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::user/237d750b-a6b3-478c-b81c-aa87dba9fff9")
-	resourceKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::endpoint/*")
-
-	db.SearchResourcesByParams(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRN.MatchingKRNs(),
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Println("-----------------------------------------------------------------------------------------------------")
-
-	fmt.Println("CASE-2.2 (specific krns): Evaluate if user has access to several resources")
-	actions = action.Action("iam:endpoint:read")
-	principalKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::user/237d750b-a6b3-478c-b81c-aa87dba9fff9")
-	resourceKRNs := krn.NewKRNArrayFromStrings("krn:yfbyqflueh:cwwardhrry::endpoint/149629b6-3264-4f23-ae3c-dd569270459a", "krn:yfbyqflueh:cwwardhrry::endpoint/7971a90a-6c70-4784-bc46-55b9b7591627", "krn:yfbyqflueh:cwwardhrry::endpoint/b840aa19-f95b-4a2b-ae6e-99e18b75432b")
-
-	db.SearchResourcesByParams(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRNs,
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Println("-----------------------------------------------------------------------------------------------------")
-
-	fmt.Println("CASE-3: Retrieve one allowed resource.")
-	actionParam := "iam:endpoint:read"
-	resourceParam := "krn:iam:kaa::endpoint/0aeaa28f-9bf0-4504-8c53-fd105e57131a"
-	principalParam := "krn:iam:kaa::user/829ede0e-c5ef-46f2-9f25-b54613cc9a17"
-	//db.FillStatementOneAllowedResource(actionParam, resourceParam, principalParam)
-	actions = action.Action(actionParam)
-	principalKRN, _ = krn.NewKRNFromString(principalParam)
-	resourceKRN, _ = krn.NewKRNFromString(resourceParam)
-
-	db.SearchResourcesByParams(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRN.MatchingKRNs(),
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Println("-----------------------------------------------------------------------------------------------------")
-
-	fmt.Println("CASE-4: Retrieve all resources: all requested resources are allowed")
-	actions = action.Action("iam:endpoint:read")
-	principalKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::*")
-	resourceKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:*")
-
-	db.SearchResourcesByParams(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRN.MatchingKRNs(),
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Println("-----------------------------------------------------------------------------------------------------")
-
-	fmt.Println("CASE-5: Retrieve all resources: all requested resources are allowed")
-	actions = action.Action("iam:endpoint:read")
-	principalKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:*")
-	resourceKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:cwwardhrry::endpoint/*")
-
-	db.SearchResourcesByParams(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRN.MatchingKRNs(),
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Println("-----------------------------------------------------------------------------------------------------")
-
-	fmt.Println("CASE-6: Retrieve one grouped by type")
-	actions = action.Action("iam:endpoint:read")
-	principalKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:*")
-	resourceKRN, _ = krn.NewKRNFromString("krn:yfbyqflueh:*")
-
-	allowed, denied, _ := db.SearchResourcesByParamsGroupingByType(&db.EvaluatePermissionRequest{
-		Actions:    actions.MatchingActionsString(),
-		Resources:  resourceKRN.MatchingKRNs(),
-		Principals: principalKRN.MatchingKRNs(),
-	})
-
-	fmt.Printf("Allowed: %v \n", allowed)
-	fmt.Printf("Denied: %v \n", denied)
+func (s *IAM) openStatementStore(cfg config.Database) (err error) {
+	switch cfg.Backend {
+	case config.BackendPostgres:
+		if s.databaseClient, err = db.NewClient(cfg); err != nil {
+			return err
+		}
+
+		for _, name := range cfg.Schemas {
+			schema, err := db.NewSchema(s.databaseClient, name)
+			if err != nil {
+				s.databaseClient.Close()
+				return err
+			}
+
+			s.schemaStores = append(s.schemaStores, db.NewSchemaStore(s.databaseClient, schema))
+		}
+
+		s.store = s.schemaStores[0]
+	case config.BackendSQLite:
+		s.store, err = db.NewSQLiteStore(cfg)
+	case config.BackendMemory:
+		s.store = db.NewMemoryStore()
+	default:
+		err = fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+
+	return err
 }
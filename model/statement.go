@@ -1,5 +1,11 @@
 package model
 
+// Statement types.
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
 type Statement struct {
 	ID         uint        `gorm:"primaryKey"`
 	Actions    actionArray `gorm:"column:actions;type:text[];index:idx_gin_statement_actions"              json:"actions"        validate:"required,gt=0,dive,required,action"`
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iam-performance-test/benchmark"
+	"iam-performance-test/config"
+	"iam-performance-test/db"
+	"iam-performance-test/model"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runScenarios runs the scenarios one after another against the store and, if explain, captures the plans of their
+// queries afterwards.
+func (s *IAM) runScenarios(ctx context.Context, store db.StatementStore, scenarios []benchmark.Scenario, explain bool) []*benchmark.Summary {
+	summaries := make([]*benchmark.Summary, 0, len(scenarios))
+
+	for i := range scenarios {
+		if i > 0 {
+			fmt.Println("-----------------------------------------------------------------------------------------------------")
+		}
+
+		if scenarios[i].Description == "" {
+			fmt.Println(strings.ToUpper(scenarios[i].Name))
+		} else {
+			fmt.Printf("%s: %s\n", strings.ToUpper(scenarios[i].Name), scenarios[i].Description)
+		}
+
+		summary, err := benchmark.Run(ctx, store, &scenarios[i], s.queryTimeout)
+		if err != nil {
+			fmt.Printf("Error occurred during running scenario: %v\n", err)
+			continue
+		}
+
+		printSummary(summary)
+
+		if explain {
+			s.explainScenario(ctx, store, &scenarios[i], summary)
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// explainScenario runs the queries of the scenario with EXPLAIN ANALYZE against the postgres store and adds their
+// plans to the summary.
+func (s *IAM) explainScenario(ctx context.Context, store db.StatementStore, scenario *benchmark.Scenario, summary *benchmark.Summary) {
+	pg, ok := store.(*db.PostgresStore)
+	if !ok {
+		return
+	}
+
+	queries, err := scenario.Queries(pg.Schema())
+	if err != nil {
+		fmt.Printf("Error occurred during building scenario queries: %v\n", err)
+		return
+	}
+
+	for i := range queries {
+		queryCtx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+		plan, err := pg.ExplainAnalyze(queryCtx, queries[i])
+		cancel()
+
+		if err != nil {
+			fmt.Printf("Error occurred during explaining query %d: %v\n", i+1, err)
+			return
+		}
+
+		f := plan.Facts
+		fmt.Printf("Plan %d: %s\n", i+1, f.Shape)
+		fmt.Printf("Rows: estimated %.0f, actual %.0f; shared buffers: hit %d, read %d; execution: %.3f ms\n",
+			f.EstimatedRows, f.ActualRows, f.SharedHitBlocks, f.SharedReadBlocks, f.ExecutionTime)
+
+		if len(f.SeqScans) > 0 {
+			fmt.Printf("Sequential scans of %s\n", strings.Join(f.SeqScans, ", "))
+		}
+
+		summary.Plans = append(summary.Plans, *plan)
+	}
+}
+
+// runWrites inserts and then deletes up to count statements of the dataset generated with the next seed, which keeps
+// them apart from the seeded ones, measuring every write and, in postgres schemas, the table rows it writes.
+func (s *IAM) runWrites(ctx context.Context, store db.StatementStore, dataset config.Dataset, count int) []*benchmark.Summary {
+	fmt.Printf("WRITES: Insert and delete %d generated statements one by one\n", count)
+
+	dataset.Seed++
+	g := db.NewGenerator(dataset)
+
+	statements := make([]*model.Statement, 0, count)
+	for statement := g.Next(); statement != nil && len(statements) < count; statement = g.Next() {
+		statements = append(statements, statement)
+	}
+
+	summaries := benchmark.RunWrites(ctx, store, statements, s.queryTimeout)
+
+	for _, summary := range summaries {
+		fmt.Println("-----------------------------------------------------------------------------------------------------")
+		fmt.Println(strings.ToUpper(summary.Scenario))
+		printSummary(summary)
+	}
+
+	return summaries
+}
+
+func (s *IAM) runLoad(ctx context.Context, load *benchmark.Load) (*benchmark.LoadResult, error) {
+	if err := load.Validate(); err != nil {
+		return nil, err
+	}
+
+	loop := "closed-loop"
+	if load.OpenLoop {
+		loop = "open-loop"
+	}
+
+	fmt.Printf("LOAD: %d scenarios %s with %d workers for %s\n", len(load.Scenarios), loop, load.Workers, load.Duration().String())
+
+	res, err := benchmark.RunLoad(ctx, s.store, load)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range res.Windows {
+		fmt.Printf("Window %s-%s: target %.1f; throughput %.1f queries/s; errors %d\n",
+			w.Start.String(), w.End.String(), w.Target, w.Throughput(), w.Errors)
+		printPercentiles("Query", &w.Latency)
+	}
+
+	for _, summary := range res.Scenarios {
+		fmt.Println("-----------------------------------------------------------------------------------------------------")
+		fmt.Println(strings.ToUpper(summary.Scenario))
+		fmt.Printf("Queries: %d; throughput: %.1f queries/s; errors: %d\n", summary.Completed(), summary.Throughput(), summary.Errors)
+		printPercentiles("Query", &summary.Latency)
+
+		if summary.Errors > 0 {
+			fmt.Printf("First error: %v\n", summary.Err)
+		}
+
+		if summary.Unexpected > 0 {
+			fmt.Printf("Unexpected results: %d; first: %v\n", summary.Unexpected, summary.Mismatch)
+		}
+	}
+
+	if res.Dropped > 0 {
+		fmt.Printf("Dropped arrivals: %d\n", res.Dropped)
+	}
+
+	return res, nil
+}
+
+// writeReport writes the report to path, which is either a .json, .csv or .md file or a directory receiving a JSON
+// report named after the mode and start time. An empty path writes nothing.
+func (s *IAM) writeReport(ctx context.Context, path string, report *benchmark.Report) error {
+	if path == "" {
+		return nil
+	}
+
+	if _, err := benchmark.FormatOf(path); err != nil {
+		path = filepath.Join(path, report.Metadata.Mode+"-"+report.Metadata.StartedAt.Format("20060102T150405Z")+".json")
+	}
+
+	if s.databaseClient != nil {
+		version, err := s.databaseClient.ServerVersion(ctx)
+		if err != nil {
+			fmt.Printf("Error occurred during reading PostgreSQL version: %v\n", err)
+		}
+
+		report.Metadata.DatabaseVersion = version
+	}
+
+	if err := report.WriteFile(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Report written to %s\n", path)
+
+	return nil
+}
+
+func printSummary(summary *benchmark.Summary) {
+	fmt.Printf("Iterations: %d of %d after %d warmup; concurrency: %d; elapsed: %s; throughput: %.1f queries/s; errors: %d\n",
+		summary.Completed(), summary.Iterations, summary.Warmup, summary.Concurrency, summary.Elapsed.String(),
+		summary.Throughput(), summary.Errors)
+	printPercentiles("Query", &summary.Latency)
+
+	switch {
+	case summary.Succeeded == 0:
+	case summary.Kind == benchmark.KindEvaluate:
+		fmt.Printf("Decision: %s\n", summary.Last.Decision)
+	case summary.Kind == benchmark.KindExplain:
+		fmt.Printf("Result count: %d; decision: %s\n", summary.Last.Count, summary.Last.Decision)
+	case summary.Kind == benchmark.KindInsert || summary.Kind == benchmark.KindDelete:
+		if summary.Rows > 0 {
+			fmt.Printf("Rows per write: %.1f\n", summary.RowsPerWrite())
+		}
+	default:
+		fmt.Printf("Result count: %d\n", summary.Last.Count)
+	}
+
+	if summary.Errors > 0 {
+		fmt.Printf("First error: %v\n", summary.Err)
+	}
+
+	if summary.Unexpected > 0 {
+		fmt.Printf("Unexpected results: %d; first: %v\n", summary.Unexpected, summary.Mismatch)
+	}
+}
+
+// probeTuples returns the named planted probes, or all of them without names, along with their tuples. The connection
+// and index modes evaluate them, so they measure hits of a seeded or imported dataset rather than misses.
+func probeTuples(names ...string) ([]db.Probe, []db.EvaluationTuple, error) {
+	named := make(map[string]bool, len(names))
+	for _, name := range names {
+		named[name] = true
+	}
+
+	var probes []db.Probe
+	var tuples []db.EvaluationTuple
+
+	for _, p := range db.Probes() {
+		if len(names) > 0 && !named[p.Name] {
+			continue
+		}
+
+		tuple, err := p.Tuple()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		probes = append(probes, p)
+		tuples = append(tuples, tuple)
+	}
+
+	return probes, tuples, nil
+}
+
+func (s *IAM) runConnectionLatency(ctx context.Context, cfg config.Database, iterations int) {
+	fmt.Println("CONNECTION: Evaluate if user has access to one resource over cold and warm connections")
+
+	// An allowed and an explicitly denied tuple, as every cold connection takes a while
+	probes, tuples, err := probeTuples("allowed", "explicit-deny")
+	if err != nil {
+		fmt.Printf("Error occurred during parsing probes: %v\n", err)
+		return
+	}
+
+	for i, tuple := range tuples {
+		latency, err := db.MeasureConnectionLatency(ctx, s.databaseClient, cfg, &db.EvaluatePermissionRequest{
+			Actions:    tuple.Action.MatchingActionsString(),
+			Resources:  tuple.Resource.MatchingKRNs(),
+			Principals: tuple.Principal.MatchingKRNs(),
+		}, iterations)
+
+		if err != nil {
+			fmt.Printf("Error occurred during measuring connection latency: %v\n", err)
+			return
+		}
+
+		printLatency("Cold connection ("+probes[i].Name+")", latency.Cold)
+		printLatency("Warm connection ("+probes[i].Name+")", latency.Warm)
+	}
+
+	stats := s.databaseClient.Stats()
+	fmt.Printf("Pool: %d open, %d in use, %d idle connections\n", stats.OpenConnections, stats.InUse, stats.Idle)
+}
+
+func (s *IAM) runIndexComparison(ctx context.Context, dataset config.Dataset, iterations int) {
+	fmt.Println("INDEX: Evaluate the access of every probe with the in-process KRN index and the store")
+
+	probes, tuples, err := probeTuples()
+	if err != nil {
+		fmt.Printf("Error occurred during parsing probes: %v\n", err)
+		return
+	}
+
+	start := time.Now()
+
+	index, err := db.LoadStatementIndex(ctx, s.store, dataset.BatchSize)
+	if err != nil {
+		fmt.Printf("Error occurred during loading statement index: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Index load took: %s; %s\n", time.Since(start).String(), index)
+
+	indexSamples := make([][]time.Duration, len(tuples))
+	storeSamples := make([][]time.Duration, len(tuples))
+
+	for i := 0; i < iterations; i++ {
+		for j, tuple := range tuples {
+			start = time.Now()
+			indexDecision, err := index.Evaluate(tuple.Principal, tuple.Action, tuple.Resource)
+			indexSamples[j] = append(indexSamples[j], time.Since(start))
+
+			if err != nil {
+				fmt.Printf("Error occurred during index evaluation: %v\n", err)
+				return
+			}
+
+			queryCtx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+			start = time.Now()
+			storeDecision, err := db.Evaluate(queryCtx, s.store, tuple.Principal, tuple.Action, tuple.Resource)
+			storeSamples[j] = append(storeSamples[j], time.Since(start))
+			cancel()
+
+			if err != nil {
+				fmt.Printf("Error occurred during store evaluation: %v\n", err)
+				return
+			}
+
+			if indexDecision != storeDecision {
+				fmt.Printf("Decisions of probe %s differ: index %s, store %s\n", probes[j].Name, indexDecision, storeDecision)
+			}
+
+			// Only the first round reports missing probes
+			if i == 0 && storeDecision != probes[j].Decision {
+				fmt.Printf("Probe %s expected %s, store decided %s; is the dataset seeded?\n", probes[j].Name, probes[j].Decision, storeDecision)
+			}
+		}
+	}
+
+	var allIndexSamples, allStoreSamples []time.Duration
+
+	for j := range probes {
+		printLatency("Index evaluation ("+probes[j].Name+")", indexSamples[j])
+		printLatency("Store evaluation ("+probes[j].Name+")", storeSamples[j])
+
+		allIndexSamples = append(allIndexSamples, indexSamples[j]...)
+		allStoreSamples = append(allStoreSamples, storeSamples[j]...)
+	}
+
+	printLatency("Index evaluation", allIndexSamples)
+	printLatency("Store evaluation", allStoreSamples)
+}
+
+func printLatency(name string, samples []time.Duration) {
+	var latency benchmark.Histogram
+	for _, sample := range samples {
+		latency.Record(sample)
+	}
+
+	printPercentiles(name, &latency)
+}
+
+func printPercentiles(name string, latency *benchmark.Histogram) {
+	if latency.Count() == 0 {
+		return
+	}
+
+	p := latency.Percentiles()
+	fmt.Printf("%s took: min %s; p50 %s; p90 %s; p99 %s; p999 %s; max %s; samples %d\n",
+		name, p.Min.String(), p.P50.String(), p.P90.String(), p.P99.String(), p.P999.String(), p.Max.String(), latency.Count())
+}
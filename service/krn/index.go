@@ -0,0 +1,181 @@
+package krn
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Index maps KRN patterns (regular or wildcard KRNs) to values, e.g. IDs of statements containing the patterns.
+//
+// The index is a trie keyed by KRN tokens and sub-tokens: service → tenant ID → pool → resource type → resource path →
+// resource ID. A wildcard pattern ends in a wildcard node at the level of its asterisk. Given a KRN, Match walks the
+// trie once, collecting values of wildcard nodes along the path, instead of expanding MatchingKRNs and looking up each
+// of them. The results are identical.
+//
+// Index is safe for concurrent use.
+type Index struct {
+	mu   sync.RWMutex
+	root *indexNode
+	size int
+}
+
+type indexNode struct {
+	// children are keyed by a token preceded by its separator, e.g. ":tenant" or "/endpoint",
+	// or by the separator and a wildcard for wildcard nodes, e.g. ":*".
+	// The root node's children are keyed by the prefix token, or the blanket wildcard.
+	children map[string]*indexNode
+	values   []uint
+}
+
+// NewIndex constructs an empty Index.
+func NewIndex() *Index {
+	return &Index{root: &indexNode{}}
+}
+
+// Insert associates value with the pattern.
+func (x *Index) Insert(pattern *KRN, value uint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	node := x.root
+	for _, key := range indexKeys(pattern.String()) {
+		child, ok := node.children[key]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*indexNode)
+			}
+
+			child = &indexNode{}
+			node.children[key] = child
+		}
+
+		node = child
+	}
+
+	node.values = append(node.values, value)
+	x.size++
+}
+
+// Remove dissociates value from the pattern and returns whether it was associated.
+func (x *Index) Remove(pattern *KRN, value uint) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	node := x.root
+	for _, key := range indexKeys(pattern.String()) {
+		if node = node.children[key]; node == nil {
+			return false
+		}
+	}
+
+	for i := range node.values {
+		if node.values[i] == value {
+			node.values = append(node.values[:i], node.values[i+1:]...)
+			x.size--
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len returns the number of (pattern, value) associations in the index.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.size
+}
+
+// Match returns the distinct values of all patterns matching k in ascending order.
+// A pattern matches k when it is one of k.MatchingKRNs().
+func (x *Index) Match(k *KRN) []uint {
+	seen := make(map[uint]void)
+	res := make([]uint, 0)
+
+	x.MatchFunc(k, func(value uint) {
+		if _, ok := seen[value]; !ok {
+			seen[value] = member
+			res = append(res, value)
+		}
+	})
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	return res
+}
+
+// MatchFunc calls fn for each value of every pattern matching k. A value is passed once per matching pattern.
+func (x *Index) MatchFunc(k *KRN, fn func(value uint)) {
+	keys := indexKeys(k.String())
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	// The blanket wildcard matches any KRN
+	if node := x.root.children[wildcard]; node != nil {
+		node.each(fn)
+	}
+
+	if keys[0] == wildcard {
+		return
+	}
+
+	node := x.root.children[keys[0]]
+	for _, key := range keys[1:] {
+		if node == nil {
+			return
+		}
+
+		wildcardKey := key[:1] + wildcard
+		if child := node.children[wildcardKey]; child != nil {
+			child.each(fn)
+		}
+
+		if key == wildcardKey {
+			// A wildcard KRN is its own most specific match, which is collected above
+			return
+		}
+
+		node = node.children[key]
+	}
+
+	if node != nil {
+		node.each(fn)
+	}
+}
+
+func (n *indexNode) each(fn func(value uint)) {
+	for _, value := range n.values {
+		fn(value)
+	}
+}
+
+// indexKeys splits a KRN string into its prefix token followed by every (sub-)token preceded by its separator.
+// The prefix token of the blanket wildcard KRN is the wildcard itself.
+func indexKeys(krn string) []string {
+	keys := make([]string, 0, strings.Count(krn, tokenSeparator)+strings.Count(krn, subtokenSeparator)+1)
+
+	start := strings.IndexAny(krn, tokenSeparator+subtokenSeparator)
+	if start < 0 {
+		return append(keys, krn)
+	}
+
+	keys = append(keys, krn[:start])
+
+	for start < len(krn) {
+		end := strings.IndexAny(krn[start+1:], tokenSeparator+subtokenSeparator)
+		if end < 0 {
+			end = len(krn)
+		} else {
+			end += start + 1
+		}
+
+		keys = append(keys, krn[start:end])
+		start = end
+	}
+
+	return keys
+}
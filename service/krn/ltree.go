@@ -0,0 +1,110 @@
+package krn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ltreeEscapes maps the KRN characters which are not allowed in ltree labels, i.e. anything but latin letters, digits
+// and underscores, to their escape sequences. Underscores themselves are the escape character.
+var ltreeEscapes = map[byte]string{
+	'_':                  "__",
+	'-':                  "_h",
+	'@':                  "_a",
+	'.':                  "_d",
+	'+':                  "_p",
+	tokenSeparator[0]:    "_c",
+	subtokenSeparator[0]: "_s",
+}
+
+// Ltree returns the PostgreSQL ltree path of the KRN. Every token or subtoken becomes a label along with the separator
+// following it, e.g. "krn:svc:tenant::endpoint/id" becomes "krn_c.svc_c.tenant_c._c.endpoint_s.id", and a wildcard KRN
+// becomes the path of the tokens preceding its asterisk, e.g. "krn:svc:tenant::*" becomes "krn_c.svc_c.tenant_c._c".
+// The blanket wildcard "*" becomes the empty path.
+//
+// Hence a KRN matches a wildcard KRN exactly when the path of the wildcard is an ancestor of the KRN path (the ltree
+// @> operator), and only equal KRNs have equal paths. The mapping is reversible, see NewKRNFromLtree.
+func (k *KRN) Ltree() string {
+	krn := strings.TrimSuffix(k.String(), wildcard)
+
+	var res strings.Builder
+
+	for i := 0; i < len(krn); i++ {
+		escape, ok := ltreeEscapes[krn[i]]
+		if !ok {
+			res.WriteByte(krn[i])
+			continue
+		}
+
+		res.WriteString(escape)
+
+		// Separators end their label
+		if (krn[i] == tokenSeparator[0] || krn[i] == subtokenSeparator[0]) && i < len(krn)-1 {
+			res.WriteByte('.')
+		}
+	}
+
+	return res.String()
+}
+
+// NewKRNFromLtree constructs a new KRN based on its ltree path as returned by KRN.Ltree.
+//
+// One of the returned values is always nil.
+func NewKRNFromLtree(path string) (*KRN, error) {
+	if path == "" {
+		return NewKRNFromString(wildcard)
+	}
+
+	var res strings.Builder
+
+	labels := strings.Split(path, ".")
+
+	for i, label := range labels {
+		separated := false
+
+		for j := 0; j < len(label); j++ {
+			if separated {
+				return nil, fmt.Errorf("%w: ltree label %d continues after its separator", ErrMalformedKRN, i)
+			}
+
+			if label[j] != '_' {
+				res.WriteByte(label[j])
+				continue
+			}
+
+			if j == len(label)-1 {
+				return nil, fmt.Errorf("%w: incomplete escape in ltree label %d", ErrMalformedKRN, i)
+			}
+
+			c, ok := ltreeUnescape(label[j : j+2])
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown escape %q in ltree label %d", ErrMalformedKRN, label[j:j+2], i)
+			}
+
+			res.WriteByte(c)
+
+			separated = c == tokenSeparator[0] || c == subtokenSeparator[0]
+			j++
+		}
+
+		switch {
+		case !separated && i < len(labels)-1:
+			return nil, fmt.Errorf("%w: ltree label %d lacks a separator", ErrMalformedKRN, i)
+		case separated && i == len(labels)-1:
+			// The path of a wildcard KRN ends with a separator
+			res.WriteString(wildcard)
+		}
+	}
+
+	return NewKRNFromString(res.String())
+}
+
+func ltreeUnescape(escape string) (byte, bool) {
+	for c, e := range ltreeEscapes {
+		if e == escape {
+			return c, true
+		}
+	}
+
+	return 0, false
+}
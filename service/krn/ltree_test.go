@@ -0,0 +1,140 @@
+package krn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var ltreeTests = []struct {
+	name, krn, path string
+}{
+	{"plain", "krn:svc:tenant::endpoint/id", "krn_c.svc_c.tenant_c._c.endpoint_s.id"},
+	{"escaped characters", "krn:my-svc:t_1@corp.io+x::endpoint/id", "krn_c.my_hsvc_c.t__1_acorp_dio_px_c._c.endpoint_s.id"},
+	{"pool", "krn:svc:tenant:/pool-1/sub:endpoint/id", "krn_c.svc_c.tenant_c._s.pool_h1_s.sub_c.endpoint_s.id"},
+	{"resource path", "krn:svc:tenant::endpoint/p1/p2/id", "krn_c.svc_c.tenant_c._c.endpoint_s.p1_s.p2_s.id"},
+	{"resource ID wildcard", "krn:svc:tenant::endpoint/*", "krn_c.svc_c.tenant_c._c.endpoint_s"},
+	{"pool wildcard", "krn:svc:tenant:/pool-1:*", "krn_c.svc_c.tenant_c._s.pool_h1_c"},
+	{"tenant wildcard", "krn:svc:tenant::*", "krn_c.svc_c.tenant_c._c"},
+	{"service wildcard", "krn:svc:*", "krn_c.svc_c"},
+	{"blanket wildcard", "*", ""},
+}
+
+func TestLtree(t *testing.T) {
+	for _, tt := range ltreeTests {
+		k, err := NewKRNFromString(tt.krn)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if got := k.Ltree(); got != tt.path {
+			t.Errorf("%s: Ltree() = %q, want %q", tt.name, got, tt.path)
+		}
+	}
+}
+
+func TestNewKRNFromLtree(t *testing.T) {
+	for _, tt := range ltreeTests {
+		k, err := NewKRNFromLtree(tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if got := k.String(); got != tt.krn {
+			t.Errorf("%s: NewKRNFromLtree(%q) = %q, want %q", tt.name, tt.path, got, tt.krn)
+		}
+	}
+}
+
+func TestLtreeEscapes(t *testing.T) {
+	seen := make(map[string]byte, len(ltreeEscapes))
+
+	for c, escape := range ltreeEscapes {
+		if len(escape) != 2 || escape[0] != '_' {
+			t.Errorf("escape %q of %q is not an underscore followed by a character", escape, c)
+		}
+
+		if other, ok := seen[escape]; ok {
+			t.Errorf("escape %q of %q is also the escape of %q", escape, c, other)
+		}
+
+		seen[escape] = c
+
+		if got, ok := ltreeUnescape(escape); !ok || got != c {
+			t.Errorf("ltreeUnescape(%q) = %q, %t, want %q", escape, got, ok, c)
+		}
+	}
+
+	for _, c := range "-_@.+:/" {
+		if _, ok := ltreeEscapes[byte(c)]; !ok {
+			t.Errorf("%q has no escape", c)
+		}
+	}
+}
+
+func TestNewKRNFromLtreeMalformed(t *testing.T) {
+	for _, path := range []string{
+		"krn_c_hx.svc_c",     // Label continues after its separator
+		"krn_c.svc_",         // Incomplete escape
+		"krn_c.svc_z",        // Unknown escape
+		"krn.svc_c",          // Label without separator
+		"krn_c.svc_c.tenant", // Not a KRN
+	} {
+		if _, err := NewKRNFromLtree(path); !errors.Is(err, ErrMalformedKRN) {
+			t.Errorf("NewKRNFromLtree(%q): got %v, want %v", path, err, ErrMalformedKRN)
+		}
+	}
+}
+
+// TestLtreeAncestorMatching checks a pattern path being an ancestor of a KRN path, i.e. the ltree @> operator,
+// exactly when the pattern is among the MatchingKRNs of the KRN.
+func TestLtreeAncestorMatching(t *testing.T) {
+	krns := []string{
+		"krn:svc:tenant::endpoint/id",
+		"krn:svc:tenant::endpoint/id2",
+		"krn:svc:tenant::endpoint/p1/p2/id",
+		"krn:svc:tenant:/pool-1/sub:endpoint/id",
+		"krn:svc:tenant-2::endpoint/id",
+		"krn:svc2:tenant::device/id",
+		"krn:s.v_c:t@x+y::endpoint/i-d",
+		"krn:svc:tenant::endpoint/*",
+		"krn:svc:tenant::*",
+	}
+
+	patterns := make(map[string]bool)
+	for _, s := range append(krns, "krn:svc:tenant::device/*", "krn:sv:*", "krn:svc:tenant::endpoint/p1/*") {
+		k, err := NewKRNFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pattern := range k.MatchingKRNs() {
+			patterns[pattern] = true
+		}
+	}
+
+	for _, s := range krns {
+		k, _ := NewKRNFromString(s)
+
+		matching := make(map[string]bool)
+		for _, pattern := range k.MatchingKRNs() {
+			matching[pattern] = true
+		}
+
+		for pattern := range patterns {
+			p, err := NewKRNFromString(pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := ltreeAncestorOrSelf(p.Ltree(), k.Ltree()); got != matching[pattern] {
+				t.Errorf("%q @> %q is %t, but %q matching %q is %t", p.Ltree(), k.Ltree(), got, pattern, s, matching[pattern])
+			}
+		}
+	}
+}
+
+// ltreeAncestorOrSelf implements the ltree @> operator.
+func ltreeAncestorOrSelf(ancestor, path string) bool {
+	return ancestor == "" || ancestor == path || strings.HasPrefix(path, ancestor+".")
+}